@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -11,6 +12,84 @@ import (
 	"github.com/pierrec/lz4"
 )
 
+/* global variable declaration, if any... */
+const (
+	backupKindBackup     = "backup"
+	backupKindSavedState = "saved state"
+	backupKindDataVolume = "data volume"
+)
+
+// pool catalogs are files, so directory can not clash with catalog of any pool
+func getBackupCatalogPath() string {
+	return filepath.Join(*catalogDir, "backups", "catalog.json")
+}
+
+// returns backups and saved domain states by path, missing catalog file is empty catalog
+func loadBackupCatalog(ctx context.Context) (map[string]BackupEntry, error) {
+	catalog := make(map[string]BackupEntry)
+
+	err := loadCatalogFile(ctx, getBackupCatalogPath(), &catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+func addBackupCatalogEntry(ctx context.Context, file, kind, source string) error {
+	id := getReqIDFromContext(ctx)
+
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+
+	catalog, err := loadBackupCatalog(ctx)
+	if err != nil {
+		return err
+	}
+
+	catalog[file] = BackupEntry{
+		Kind:    kind,
+		Source:  source,
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	err = saveCatalogFile(ctx, getBackupCatalogPath(), catalog)
+	if err != nil {
+		return err
+	}
+
+	info.Printf("%sadded %s %s to backup catalog\n", id, kind, file)
+	return nil
+}
+
+// removes entry of deleted file, file missing in catalog is not an error
+func removeBackupCatalogEntry(ctx context.Context, file string) error {
+	id := getReqIDFromContext(ctx)
+
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+
+	catalog, err := loadBackupCatalog(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := catalog[file]; !ok {
+		return nil
+	}
+
+	delete(catalog, file)
+
+	err = saveCatalogFile(ctx, getBackupCatalogPath(), catalog)
+	if err != nil {
+		return err
+	}
+
+	info.Printf("%sremoved %s from backup catalog\n", id, file)
+	return nil
+}
+
+// backup outlives domain, it is recorded in backup catalog, so it is not collected as orphan
 func createBackup(ctx context.Context, c *libvirt.Connect, inputFile string) error {
 	id := getReqIDFromContext(ctx)
 
@@ -25,6 +104,11 @@ func createBackup(ctx context.Context, c *libvirt.Connect, inputFile string) err
 		return err
 	}
 
+	err = addBackupCatalogEntry(ctx, outputFile, backupKindBackup, path.Clean(inputFile))
+	if err != nil {
+		return err
+	}
+
 	info.Printf("%sfinished backup for %s\n", id, inputFile)
 	return nil
 }
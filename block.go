@@ -47,9 +47,8 @@ func getDomainBlockJobInfo(ctx context.Context, d *libvirt.Domain, disk string)
 	return jobInfo, nil
 }
 
-func setDomainBlockIoTune(ctx context.Context, d *libvirt.Domain, dev string, read uint64, write uint64) error {
-	id := getReqIDFromContext(ctx)
-
+// modification impact on persistent config and, for active domain, on live config
+func getDomainModificationImpact(ctx context.Context, d *libvirt.Domain) libvirt.DomainModificationImpact {
 	flags := libvirt.DOMAIN_AFFECT_CURRENT
 
 	if ok := isDomainPersistent(ctx, d); ok {
@@ -60,20 +59,37 @@ func setDomainBlockIoTune(ctx context.Context, d *libvirt.Domain, dev string, re
 		flags = flags | libvirt.DOMAIN_AFFECT_LIVE
 	}
 
+	return flags
+}
+
+func setDomainBlockIoTune(ctx context.Context, d *libvirt.Domain, dev string, read uint64, write uint64) error {
+	id := getReqIDFromContext(ctx)
+
+	flags := getDomainModificationImpact(ctx, d)
+
 	var s libvirt.DomainBlockIoTuneParameters
 
 	s.ReadIopsSecSet = true
 	s.ReadIopsSec = read
-	s.ReadIopsSecMaxSet = true
-	s.ReadIopsSecMax = read + 100
-	s.ReadIopsSecMaxLengthSet = true
-	s.ReadIopsSecMaxLength = 15
 	s.WriteIopsSecSet = true
 	s.WriteIopsSec = write
-	s.WriteIopsSecMaxSet = true
-	s.WriteIopsSecMax = write + 50
-	s.WriteIopsSecMaxLengthSet = true
-	s.WriteIopsSecMaxLength = 5
+
+	// burst above limit and its length are taken from default block IO profile
+	p := blockIOProfiles[defaultBlockIOProfile]
+
+	if p.ReadIopsSecMax != 0 {
+		s.ReadIopsSecMaxSet = true
+		s.ReadIopsSecMax = read + p.ReadIopsSecMax - p.ReadIopsSec
+		s.ReadIopsSecMaxLengthSet = true
+		s.ReadIopsSecMaxLength = p.ReadIopsSecMaxLength
+	}
+
+	if p.WriteIopsSecMax != 0 {
+		s.WriteIopsSecMaxSet = true
+		s.WriteIopsSecMax = write + p.WriteIopsSecMax - p.WriteIopsSec
+		s.WriteIopsSecMaxLengthSet = true
+		s.WriteIopsSecMaxLength = p.WriteIopsSecMaxLength
+	}
 
 	err := d.SetBlockIoTune(dev, &s, flags)
 	if err != nil {
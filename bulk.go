@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libvirt/libvirt-go"
+)
+
+/* global variable declaration, if any... */
+const (
+	bulkActionStart    = "start"
+	bulkActionShutdown = "shutdown"
+	bulkActionReboot   = "reboot"
+	bulkActionSuspend  = "suspend"
+	bulkActionSnapshot = "snapshot"
+)
+
+const (
+	// domains with higher priority are started first, missing or not numeric label is priority 0
+	bulkPriorityLabel = "priority"
+
+	bulkDefaultParallelism = 4
+)
+
+var bulkActions = []string{bulkActionStart, bulkActionShutdown, bulkActionReboot, bulkActionSuspend, bulkActionSnapshot}
+
+type bulkDomain struct {
+	index    int
+	name     string
+	priority int
+	dom      *libvirt.Domain
+}
+
+func getDomainPriority(ctx context.Context, d *libvirt.Domain) int {
+	labels, err := getDomainLabels(ctx, d)
+	if err != nil {
+		return 0
+	}
+
+	priority, err := strconv.Atoi(labels[bulkPriorityLabel])
+	if err != nil {
+		return 0
+	}
+
+	return priority
+}
+
+// runs single bulk action on domain with the same checks as corresponding JRPC function
+func runDomainAction(ctx context.Context, d *libvirt.Domain, action, snapshotName string) error {
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return errors.New("sanity lock, block device job is currently in process")
+	}
+
+	switch action {
+	case bulkActionStart:
+		return startDomain(ctx, d)
+
+	case bulkActionShutdown:
+		return shutdownDomain(ctx, d, libvirt.DOMAIN_SHUTDOWN_DEFAULT)
+
+	case bulkActionReboot:
+		return rebootDomain(ctx, d, libvirt.DOMAIN_REBOOT_DEFAULT)
+
+	case bulkActionSuspend:
+		if !isDomainActive(ctx, d) {
+			return errors.New("domain must be active while being suspended")
+		}
+
+		return suspendDomain(ctx, d)
+
+	case bulkActionSnapshot:
+		if isDomainActive(ctx, d) {
+			return errors.New("domain must not be active while creating internal snapshot")
+		}
+
+		ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return errors.New("sanity lock, domain has unfinished internal backup")
+		}
+
+		xml, err := prepareXMLForSnapshot(ctx, d, snapshotName, true)
+		if err != nil {
+			return err
+		}
+
+		ok, err = makeDomainSnapshot(ctx, d, libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC|libvirt.DOMAIN_SNAPSHOT_CREATE_HALT, xml)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("failed to create snapshot")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown bulk action: %s", action)
+}
+
+// groups domains by priority for start action, other actions run as single group
+func getBulkDomainGroups(ctx context.Context, domains []libvirt.Domain, action string) [][]bulkDomain {
+	items := make([]bulkDomain, 0, len(domains))
+
+	for i := range domains {
+		item := bulkDomain{
+			name: getDomainName(ctx, &domains[i]),
+			dom:  &domains[i],
+		}
+
+		if action == bulkActionStart {
+			item.priority = getDomainPriority(ctx, &domains[i])
+		}
+
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].priority != items[j].priority {
+			return items[i].priority > items[j].priority
+		}
+
+		return items[i].name < items[j].name
+	})
+
+	groups := make([][]bulkDomain, 0)
+
+	for i := range items {
+		items[i].index = i
+
+		if len(groups) == 0 || groups[len(groups)-1][0].priority != items[i].priority {
+			groups = append(groups, []bulkDomain{})
+		}
+
+		groups[len(groups)-1] = append(groups[len(groups)-1], items[i])
+	}
+
+	return groups
+}
+
+// runs action over domains with bounded concurrency, priority groups are processed one after another
+func runBulkAction(ctx context.Context, domains []libvirt.Domain, action string, parallelism int, stopOnError bool) []BulkActionResult {
+	id := getReqIDFromContext(ctx)
+
+	if parallelism < 1 {
+		parallelism = bulkDefaultParallelism
+	}
+
+	snapshotName := fmt.Sprintf("bulk-%s", time.Now().Format("20060102150405"))
+
+	results := make([]BulkActionResult, len(domains))
+
+	var stopped atomic.Bool
+
+	for _, group := range getBulkDomainGroups(ctx, domains, action) {
+		sem := make(chan struct{}, parallelism)
+
+		var wg sync.WaitGroup
+
+		for _, item := range group {
+			sem <- struct{}{}
+
+			results[item.index] = BulkActionResult{Domain: item.name}
+
+			if stopped.Load() {
+				results[item.index].Skipped = true
+				<-sem
+				continue
+			}
+
+			wg.Add(1)
+
+			go func(item bulkDomain) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				r := &results[item.index]
+
+				if isLockedAndMakeLock(ctx, item.name, 10) {
+					r.Error = "thread safety lock, function is temporarily unavailable"
+				} else if err := runDomainAction(ctx, item.dom, action, snapshotName); err != nil {
+					r.Error = err.Error()
+				} else {
+					r.Success = true
+				}
+
+				if !r.Success && stopOnError {
+					stopped.Store(true)
+				}
+			}(item)
+		}
+
+		wg.Wait()
+	}
+
+	info.Printf("%sfinished bulk action %s on %d domain(s)\n", id, action, len(domains))
+	return results
+}
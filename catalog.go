@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libvirt/libvirt-go"
+)
+
+/* global variable declaration, if any... */
+var catalogMutex sync.Mutex // serializes read-modify-write of catalog files
+
+func getCatalogPath(pool string) string {
+	return filepath.Join(*catalogDir, pool+".json")
+}
+
+// reads JSON catalog file into v, missing file leaves v untouched
+func loadCatalogFile(ctx context.Context, path string, v interface{}) error {
+	id := getReqIDFromContext(ctx)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		fail.Printf("%sfailed to read catalog %s: %s\n", id, path, err.Error())
+		return err
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		fail.Printf("%sfailed to parse catalog %s: %s\n", id, path, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// writes JSON catalog file through temporary file, so catalog is never left half written
+func saveCatalogFile(ctx context.Context, path string, v interface{}) error {
+	id := getReqIDFromContext(ctx)
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fail.Printf("%sfailed to marshal catalog: %s\n", id, err.Error())
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		fail.Printf("%sfailed to create catalog directory %s: %s\n", id, filepath.Dir(path), err.Error())
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		fail.Printf("%sfailed to write catalog %s: %s\n", id, tmp, err.Error())
+		return err
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		fail.Printf("%sfailed to replace catalog %s: %s\n", id, path, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// returns image templates registered in storage pool, missing catalog file is empty catalog
+func loadPoolCatalog(ctx context.Context, pool string) (map[string]ImageTemplate, error) {
+	catalog := make(map[string]ImageTemplate)
+
+	err := loadCatalogFile(ctx, getCatalogPath(pool), &catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+func savePoolCatalog(ctx context.Context, pool string, catalog map[string]ImageTemplate) error {
+	id := getReqIDFromContext(ctx)
+
+	err := saveCatalogFile(ctx, getCatalogPath(pool), catalog)
+	if err != nil {
+		return err
+	}
+
+	info.Printf("%ssaved template catalog of storage pool %s\n", id, pool)
+	return nil
+}
+
+// returns catalog entry of template, ok is false for template not registered in catalog
+func getImageTemplate(ctx context.Context, pool, name string) (ImageTemplate, bool, error) {
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+
+	catalog, err := loadPoolCatalog(ctx, pool)
+	if err != nil {
+		return ImageTemplate{}, false, err
+	}
+
+	t, ok := catalog[name]
+
+	return t, ok, nil
+}
+
+// lists registered templates together with unregistered volumes named as templates
+func listImageTemplates(ctx context.Context, c *libvirt.Connect, pool string) ([]ImageTemplate, error) {
+	id := getReqIDFromContext(ctx)
+
+	p, err := lookupPoolByName(ctx, c, pool)
+	if err != nil {
+		return nil, err
+	}
+	defer freePool(ctx, p)
+
+	volumes, err := listPoolVolumes(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogMutex.Lock()
+	catalog, err := loadPoolCatalog(ctx, pool)
+	catalogMutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]ImageTemplate, 0)
+
+	for _, v := range volumes {
+		if t, ok := catalog[v]; ok {
+			t.Registered = true
+			r = append(r, t)
+			continue
+		}
+
+		if strings.Contains(v, "template") {
+			r = append(r, ImageTemplate{Name: v})
+		}
+	}
+
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+
+	info.Printf("%sacquired %d template(s) of storage pool %s\n", id, len(r), pool)
+	return r, nil
+}
+
+// computes SHA-256 of volume data, as it is downloaded over HTTP
+func getVolumeChecksum(ctx context.Context, c *libvirt.Connect, pool, name string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	v, err := lookupPoolVolume(ctx, c, pool, name)
+	if err != nil {
+		return "", err
+	}
+	defer freeVolume(ctx, v)
+
+	size, err := getVolumeTransferSize(ctx, v)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+
+	if size != 0 {
+		err = downloadVolume(ctx, c, v, transferRange{length: size, total: size}, true, h)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	info.Printf("%scomputed checksum of %s/%s: %s\n", id, pool, name, sum)
+	return sum, nil
+}
+
+func validateImageTemplate(t ImageTemplate) error {
+	problems := make([]error, 0)
+
+	if len(t.Name) == 0 {
+		problems = append(problems, fmt.Errorf("template name can not be empty"))
+	}
+
+	if len(t.SHA256) != 0 {
+		if b, err := hex.DecodeString(t.SHA256); err != nil || len(b) != sha256.Size {
+			problems = append(problems, fmt.Errorf("not valid SHA-256 checksum: %s", t.SHA256))
+		}
+	}
+
+	if len(problems) != 0 {
+		msgs := make([]string, 0, len(problems))
+		for _, p := range problems {
+			msgs = append(msgs, p.Error())
+		}
+
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+// registers template volume in catalog of storage pool, empty checksum is computed from volume data
+func registerImageTemplate(ctx context.Context, c *libvirt.Connect, pool string, t ImageTemplate) (ImageTemplate, error) {
+	id := getReqIDFromContext(ctx)
+
+	err := validateImageTemplate(t)
+	if err != nil {
+		fail.Printf("%sfailed to validate template: %s\n", id, err.Error())
+		return ImageTemplate{}, err
+	}
+
+	_, err = isTemplateInsideStorageAvailable(ctx, c, pool, t.Name)
+	if err != nil {
+		return ImageTemplate{}, err
+	}
+
+	sum, err := getVolumeChecksum(ctx, c, pool, t.Name)
+	if err != nil {
+		return ImageTemplate{}, err
+	}
+
+	if len(t.SHA256) != 0 && !strings.EqualFold(t.SHA256, sum) {
+		fail.Printf("%schecksum mismatch for template %s/%s, expected %s, volume has %s\n", id, pool, t.Name, t.SHA256, sum)
+		return ImageTemplate{}, fmt.Errorf("checksum mismatch for template %s/%s, expected %s, volume has %s", pool, t.Name, t.SHA256, sum)
+	}
+
+	t.SHA256 = sum
+	t.Registered = true
+	t.Verified = time.Now().UTC().Format(time.RFC3339)
+
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+
+	catalog, err := loadPoolCatalog(ctx, pool)
+	if err != nil {
+		return ImageTemplate{}, err
+	}
+
+	catalog[t.Name] = t
+
+	err = savePoolCatalog(ctx, pool, catalog)
+	if err != nil {
+		return ImageTemplate{}, err
+	}
+
+	info.Printf("%sregistered template %s in storage pool %s\n", id, t.Name, pool)
+	return t, nil
+}
+
+// recomputes checksum of registered template and compares it with catalog
+func verifyImageTemplate(ctx context.Context, c *libvirt.Connect, pool, name string) (VerifyImageTemplateResponse, error) {
+	id := getReqIDFromContext(ctx)
+
+	t, ok, err := getImageTemplate(ctx, pool, name)
+	if err != nil {
+		return VerifyImageTemplateResponse{}, err
+	}
+
+	if !ok {
+		fail.Printf("%stemplate %s is not registered in storage pool %s\n", id, name, pool)
+		return VerifyImageTemplateResponse{}, fmt.Errorf("template %s is not registered in storage pool %s", name, pool)
+	}
+
+	sum, err := getVolumeChecksum(ctx, c, pool, name)
+	if err != nil {
+		return VerifyImageTemplateResponse{}, err
+	}
+
+	r := VerifyImageTemplateResponse{
+		Name:     name,
+		Expected: t.SHA256,
+		Actual:   sum,
+		Valid:    strings.EqualFold(t.SHA256, sum),
+	}
+
+	if !r.Valid {
+		fail.Printf("%stemplate %s/%s is corrupted, expected %s, volume has %s\n", id, pool, name, t.SHA256, sum)
+		return r, nil
+	}
+
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+
+	catalog, err := loadPoolCatalog(ctx, pool)
+	if err != nil {
+		return r, err
+	}
+
+	if entry, ok := catalog[name]; ok {
+		entry.Verified = time.Now().UTC().Format(time.RFC3339)
+		catalog[name] = entry
+
+		err = savePoolCatalog(ctx, pool, catalog)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	info.Printf("%stemplate %s/%s checksum is valid\n", id, pool, name)
+	return r, nil
+}
+
+// checks domain options against minimum requirements of registered template, returns disk size new volume must be grown to (0 to keep template size)
+func checkImageTemplateRequirements(ctx context.Context, c *libvirt.Connect, pool, name string, memory uint, cloudInit bool) (uint64, error) {
+	id := getReqIDFromContext(ctx)
+
+	t, ok, err := getImageTemplate(ctx, pool, name)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	problems := make([]string, 0)
+
+	if t.MinMemory != 0 && uint64(memory) < t.MinMemory {
+		problems = append(problems, fmt.Sprintf("memory %d KiB is less than template minimum %d KiB", memory, t.MinMemory))
+	}
+
+	if cloudInit && !t.CloudInit {
+		problems = append(problems, "template does not support cloud-init")
+	}
+
+	if len(problems) != 0 {
+		fail.Printf("%stemplate %s/%s requirements are not met: %s\n", id, pool, name, strings.Join(problems, "; "))
+		return 0, fmt.Errorf("template %s/%s requirements are not met: %s", pool, name, strings.Join(problems, "; "))
+	}
+
+	if t.MinDisk == 0 {
+		return 0, nil
+	}
+
+	capacity, err := getVolumeCapacity(ctx, c, pool, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if capacity >= t.MinDisk {
+		return 0, nil
+	}
+
+	info.Printf("%sdisk cloned from template %s/%s will be grown to %d bytes\n", id, pool, name, t.MinDisk)
+	return t.MinDisk, nil
+}
+
+// grows volume cloned from registered template to template minimum disk size
+func growVolumeToTemplateMinimum(ctx context.Context, c *libvirt.Connect, pool, template, name string) error {
+	t, ok, err := getImageTemplate(ctx, pool, template)
+	if err != nil || !ok || t.MinDisk == 0 {
+		return err
+	}
+
+	capacity, err := getVolumeCapacity(ctx, c, pool, name)
+	if err != nil || capacity >= t.MinDisk {
+		return err
+	}
+
+	return resizePoolVolume(ctx, c, pool, name, t.MinDisk)
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+func getVolumePoolAndName(ctx context.Context, c *libvirt.Connect, path string) (string, string, error) {
+	id := getReqIDFromContext(ctx)
+
+	vol, err := lookupStorageVolByPath(ctx, c, path)
+	if err != nil {
+		return "", "", err
+	}
+	defer freeVolume(ctx, vol)
+
+	volName, err := vol.GetName()
+	if err != nil {
+		fail.Printf("%sfailed to get storage volume name for %s: %s\n", id, path, err.Error())
+		return "", "", err
+	}
+
+	pool, err := lookupPoolByVolume(ctx, vol)
+	if err != nil {
+		return "", "", err
+	}
+	defer freePool(ctx, pool)
+
+	poolName, err := getPoolName(ctx, pool)
+	if err != nil {
+		return "", "", err
+	}
+
+	info.Printf("%sstorage volume %s is %s/%s\n", id, path, poolName, volName)
+	return poolName, volName, nil
+}
+
+// first disk follows <name>.qcow2 convention, others are named <name>-<target>.qcow2
+func getDomainDiskImageName(domainName string, diskIndex int, target string) string {
+	if diskIndex == 0 {
+		return fmt.Sprintf("%s.qcow2", domainName)
+	}
+
+	return fmt.Sprintf("%s-%s.qcow2", domainName, target)
+}
+
+func getDomainInactiveConfig(ctx context.Context, d *libvirt.Domain) (*libvirtxml.Domain, error) {
+	id := getReqIDFromContext(ctx)
+
+	xmlDoc, err := getDomainXML(ctx, d, libvirt.DOMAIN_XML_INACTIVE|libvirt.DOMAIN_XML_SECURE)
+	if err != nil {
+		return nil, err
+	}
+
+	domCfg := &libvirtxml.Domain{}
+	err = domCfg.Unmarshal(xmlDoc)
+	if err != nil {
+		fail.Printf("%sfailed to parse domain XML: %s\n", id, err.Error())
+		return nil, err
+	}
+
+	if domCfg.Devices == nil {
+		fail.Printf("%sfailed to parse domain XML: %s\n", id, errors.New("domain xml device section is empty"))
+		return nil, errors.New("domain xml device section is empty")
+	}
+
+	info.Printf("%sparsed domain XML\n", id)
+	return domCfg, nil
+}
+
+// returns storage pool and volume name of domain disk, disk which is not backed by storage pool volume can not be cloned or moved
+func getDomainDiskPoolVolume(ctx context.Context, c *libvirt.Connect, disk libvirtxml.DomainDisk) (string, string, error) {
+	id := getReqIDFromContext(ctx)
+
+	switch {
+	case disk.Source.File != nil:
+		return getVolumePoolAndName(ctx, c, disk.Source.File.File)
+	case disk.Source.Block != nil:
+		return getVolumePoolAndName(ctx, c, disk.Source.Block.Dev)
+	case disk.Source.Volume != nil:
+		return disk.Source.Volume.Pool, disk.Source.Volume.Volume, nil
+	}
+
+	fail.Printf("%sdisk %s is not backed by storage pool volume\n", id, disk.Target.Dev)
+	return "", "", fmt.Errorf("disk %s is not backed by storage pool volume", disk.Target.Dev)
+}
+
+// points domain disk to another volume of same storage pool
+func setDomainDiskPoolVolume(disk *libvirtxml.DomainDisk, volName, path string) {
+	switch {
+	case disk.Source.File != nil:
+		disk.Source.File.File = path
+	case disk.Source.Block != nil:
+		disk.Source.Block.Dev = path
+	case disk.Source.Volume != nil:
+		disk.Source.Volume.Volume = volName
+	}
+}
+
+func copyFile(from, to string, perm os.FileMode) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		os.Remove(to)
+		return err
+	}
+
+	return out.Close()
+}
+
+// clone gets its own copy of UEFI variables store, next to the source one: <nvram dir>/<name>_VARS.fd
+func txCopyDomainNVRAM(ctx context.Context, tx *transaction, domCfg *libvirtxml.Domain, newName string) error {
+	if domCfg.OS == nil || domCfg.OS.NVRam == nil || len(domCfg.OS.NVRam.NVRam) == 0 {
+		return nil
+	}
+
+	oldPath := domCfg.OS.NVRam.NVRam
+	newPath := filepath.Join(filepath.Dir(oldPath), fmt.Sprintf("%s_VARS.fd", newName))
+
+	err := tx.do("copy NVRAM "+newPath,
+		func() error {
+			_, err := os.Stat(oldPath)
+			if os.IsNotExist(err) {
+				// variables store of domain which never started is created by libvirt from template
+				return nil
+			}
+
+			return copyFile(oldPath, newPath, 0600)
+		},
+		func() error {
+			err := os.Remove(newPath)
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	domCfg.OS.NVRam.NVRam = newPath
+
+	return nil
+}
+
+func cloneDomain(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain, newName string) error {
+	id := getReqIDFromContext(ctx)
+
+	domCfg, err := getDomainInactiveConfig(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	// clone keeps tenant of source domain
+	err = checkDomainConfigTenantQuota(ctx, c, domCfg)
+	if err != nil {
+		return err
+	}
+
+	removeCloudInitSeedFromDomainConfig(domCfg)
+
+	tx := newTransaction(ctx)
+
+	var diskIndex int
+
+	for i, disk := range domCfg.Devices.Disks {
+		if disk.Device != "disk" || disk.Source == nil || disk.Target == nil {
+			continue
+		}
+
+		storage, volName, err := getDomainDiskPoolVolume(ctx, c, disk)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+
+		newVolName := getDomainDiskImageName(newName, diskIndex, disk.Target.Dev)
+
+		newVolPath, err := getPoolFilePath(ctx, c, storage, newVolName)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+
+		vol, err := lookupStorageVolByPath(ctx, c, newVolPath)
+		if err == nil {
+			freeVolume(ctx, vol)
+			tx.rollback()
+			return fmt.Errorf("image: %s exists", newVolPath)
+		}
+
+		err = txCloneVolume(ctx, tx, c, storage, volName, newVolName, false)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+
+		setDomainDiskPoolVolume(&domCfg.Devices.Disks[i], newVolName, newVolPath)
+		diskIndex++
+	}
+
+	err = txCopyDomainNVRAM(ctx, tx, domCfg, newName)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+
+	for i, iface := range domCfg.Devices.Interfaces {
+		if iface.Source != nil && iface.Source.Network != nil && strings.HasPrefix(iface.Source.Network.Network, "pf-") {
+			ok, err := isNetworkVFAvailable(ctx, c, iface.Source.Network.Network)
+			if err != nil || !ok {
+				tx.rollback()
+				return fmt.Errorf("failed to reallocate VF on network %s: %v", iface.Source.Network.Network, err)
+			}
+		}
+
+		domCfg.Devices.Interfaces[i].MAC = &libvirtxml.DomainInterfaceMAC{
+			Address: genMAC(ctx),
+		}
+		domCfg.Devices.Interfaces[i].Target = nil
+		domCfg.Devices.Interfaces[i].Alias = nil
+	}
+
+	domCfg.Name = newName
+	domCfg.UUID = genUUID(ctx)
+	domCfg.ID = nil
+
+	xml, err := domCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal domain XML: %s\n", id, err.Error())
+		tx.rollback()
+		return err
+	}
+
+	dom, err := defineDomain(ctx, c, xml)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+	defer freeDomain(ctx, dom)
+
+	info.Printf("%scloned domain to: %s\n", id, newName)
+	return nil
+}
+
+// returns new volume name of disk following <name>.qcow2 or <name>-<target>.qcow2 convention, empty for other disks
+func getRenamedDiskImageName(volName, oldName, newName string) string {
+	switch {
+	case volName == fmt.Sprintf("%s.qcow2", oldName):
+		return fmt.Sprintf("%s.qcow2", newName)
+	case strings.HasPrefix(volName, fmt.Sprintf("%s-", oldName)) && strings.HasSuffix(volName, ".qcow2"):
+		return newName + strings.TrimPrefix(volName, oldName)
+	}
+
+	return ""
+}
+
+// disks are copied to volumes with new names through storage pool, old volumes are removed after domain is redefined
+func renameDomain(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain, newName string) error {
+	id := getReqIDFromContext(ctx)
+
+	oldName := getDomainName(ctx, d)
+	if len(oldName) == 0 {
+		return errors.New("failed to get domain name")
+	}
+
+	err := d.Rename(newName, 0)
+	if err != nil {
+		fail.Printf("%sfailed to rename domain %s to %s: %s\n", id, oldName, newName, err.Error())
+		return err
+	}
+	info.Printf("%srenamed domain %s to %s\n", id, oldName, newName)
+
+	tx := newTransaction(ctx)
+
+	rollback := func() {
+		tx.rollback()
+
+		err := d.Rename(oldName, 0)
+		if err != nil {
+			fail.Printf("%sfailed to rename domain %s back to %s: %s\n", id, newName, oldName, err.Error())
+		}
+	}
+
+	domCfg, err := getDomainInactiveConfig(ctx, d)
+	if err != nil {
+		rollback()
+		return err
+	}
+
+	moved := make([]string, 0)
+
+	for i, disk := range domCfg.Devices.Disks {
+		if disk.Device != "disk" || disk.Source == nil || disk.Source.File == nil {
+			continue
+		}
+
+		oldPath := disk.Source.File.File
+
+		storage, volName, err := getVolumePoolAndName(ctx, c, oldPath)
+		if err != nil {
+			rollback()
+			return err
+		}
+
+		newVolName := getRenamedDiskImageName(volName, oldName, newName)
+		if len(newVolName) == 0 {
+			info.Printf("%sdisk %s does not follow naming convention, not moving\n", id, oldPath)
+			continue
+		}
+
+		poolType, err := getPoolType(ctx, c, storage)
+		if err != nil {
+			rollback()
+			return err
+		}
+
+		if !isPoolFileBased(poolType) {
+			fail.Printf("%sdisk %s can be moved only in file based storage pool, %s is %s pool\n", id, oldPath, storage, poolType)
+			rollback()
+			return fmt.Errorf("disk %s can be moved only in file based storage pool, %s is %s pool", oldPath, storage, poolType)
+		}
+
+		// overlay keeps path of its backing file
+		err = checkVolumeHasNoOverlays(ctx, c, oldPath)
+		if err != nil {
+			rollback()
+			return err
+		}
+
+		newPath, err := getPoolFilePath(ctx, c, storage, newVolName)
+		if err != nil {
+			rollback()
+			return err
+		}
+
+		vol, err := lookupStorageVolByPath(ctx, c, newPath)
+		if err == nil {
+			freeVolume(ctx, vol)
+			rollback()
+			return fmt.Errorf("image: %s exists", newPath)
+		}
+
+		err = txCloneVolume(ctx, tx, c, storage, volName, newVolName, false)
+		if err != nil {
+			rollback()
+			return err
+		}
+		info.Printf("%scopied %s to %s\n", id, oldPath, newPath)
+
+		moved = append(moved, oldPath)
+		domCfg.Devices.Disks[i].Source.File.File = newPath
+	}
+
+	if len(moved) == 0 {
+		return nil
+	}
+
+	xml, err := domCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal domain XML: %s\n", id, err.Error())
+		rollback()
+		return err
+	}
+
+	dom, err := defineDomain(ctx, c, xml)
+	if err != nil {
+		rollback()
+		return err
+	}
+	defer freeDomain(ctx, dom)
+
+	// domain already uses new volumes, volume left behind is reported by FindOrphans
+	for _, path := range moved {
+		err = removeVolumeByPath(ctx, c, path)
+		if err != nil {
+			fail.Printf("%sfailed to remove %s after move: %s\n", id, path, err.Error())
+		}
+	}
+
+	info.Printf("%smoved disks of domain %s to match new name\n", id, newName)
+	return nil
+}
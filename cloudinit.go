@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+/* global variable declaration, if any... */
+const (
+	cloudInitVolumeID   = "cidata"
+	cloudInitSeedSuffix = "-cidata.iso"
+)
+
+func getCloudInitSeedName(domainName string) string {
+	return domainName + cloudInitSeedSuffix
+}
+
+// https://cloudinit.readthedocs.io/en/latest/reference/datasources/nocloud.html
+func buildCloudInitSeed(ctx context.Context, uuid, name, userData, networkConfig string) ([]byte, error) {
+	id := getReqIDFromContext(ctx)
+
+	files := []isoFile{
+		{
+			name: "meta-data",
+			data: []byte(fmt.Sprintf("instance-id: %s\nlocal-hostname: %s\n", uuid, name)),
+		},
+	}
+
+	if len(networkConfig) != 0 {
+		files = append(files, isoFile{name: "network-config", data: []byte(networkConfig)})
+	}
+
+	files = append(files, isoFile{name: "user-data", data: []byte(userData)})
+
+	iso, err := buildISO9660(cloudInitVolumeID, files)
+	if err != nil {
+		fail.Printf("%sfailed to build cloud-init seed image: %s\n", id, err.Error())
+		return nil, err
+	}
+
+	info.Printf("%sbuilt cloud-init seed image for domain %s\n", id, name)
+	return iso, nil
+}
+
+func writeCloudInitSeed(ctx context.Context, c *libvirt.Connect, storage, path string, iso []byte) error {
+	id := getReqIDFromContext(ctx)
+
+	_, err := os.Stat(path)
+	if err == nil {
+		return fmt.Errorf("image: %s exists", path)
+	}
+
+	err = os.WriteFile(path, iso, 0o644)
+	if err != nil {
+		fail.Printf("%sfailed to write cloud-init seed image %s: %s\n", id, path, err.Error())
+		return err
+	}
+	info.Printf("%swrote cloud-init seed image %s\n", id, path)
+
+	pool, err := lookupPoolByName(ctx, c, storage)
+	if err != nil {
+		return err
+	}
+	defer freePool(ctx, pool)
+
+	return refreshPool(ctx, pool)
+}
+
+func txWriteCloudInitSeed(ctx context.Context, tx *transaction, c *libvirt.Connect, storage, uuid, name, userData, networkConfig string) (string, error) {
+	iso, err := buildCloudInitSeed(ctx, uuid, name, userData, networkConfig)
+	if err != nil {
+		return "", err
+	}
+
+	poolType, err := getPoolType(ctx, c, storage)
+	if err != nil {
+		return "", err
+	}
+
+	// seed image is written directly to pool directory
+	if !isPoolFileBased(poolType) {
+		return "", fmt.Errorf("cloud-init seed image requires directory based storage pool, %s is of type %s", storage, poolType)
+	}
+
+	path, err := getPoolFilePath(ctx, c, storage, getCloudInitSeedName(name))
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.do("write cloud-init seed "+path,
+		func() error {
+			return writeCloudInitSeed(ctx, c, storage, path, iso)
+		},
+		func() error {
+			return removeVolumeByPath(ctx, c, path)
+		},
+	)
+
+	return path, err
+}
+
+// attaches seed image as read-only CD-ROM on first free IDE target
+func addCloudInitSeedToDomainConfig(domCfg *libvirtxml.Domain, path string) error {
+	if domCfg.Devices == nil {
+		return errors.New("domain xml device section is empty")
+	}
+
+	used := make(map[string]bool)
+	for _, disk := range domCfg.Devices.Disks {
+		if disk.Target != nil {
+			used[disk.Target.Dev] = true
+		}
+	}
+
+	for _, dev := range []string{"hda", "hdb", "hdc", "hdd"} {
+		if used[dev] {
+			continue
+		}
+
+		domCfg.Devices.Disks = append(domCfg.Devices.Disks, libvirtxml.DomainDisk{
+			Device: "cdrom",
+			Driver: &libvirtxml.DomainDiskDriver{
+				Name: "qemu",
+				Type: "raw",
+			},
+			Source: &libvirtxml.DomainDiskSource{
+				File: &libvirtxml.DomainDiskSourceFile{
+					File: path,
+				},
+			},
+			Target: &libvirtxml.DomainDiskTarget{
+				Dev: dev,
+				Bus: "ide",
+			},
+			ReadOnly: &libvirtxml.DomainDiskReadOnly{},
+		})
+
+		return nil
+	}
+
+	return errors.New("no free IDE target for cloud-init seed image")
+}
+
+func addCloudInitSeedToDomainXML(ctx context.Context, xml, path string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	domCfg := &libvirtxml.Domain{}
+	err := domCfg.Unmarshal(xml)
+	if err != nil {
+		fail.Printf("%sfailed to parse domain XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	err = addCloudInitSeedToDomainConfig(domCfg, path)
+	if err != nil {
+		fail.Printf("%sfailed to attach cloud-init seed image: %s\n", id, err.Error())
+		return "", err
+	}
+
+	xml, err = domCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal domain XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	return xml, nil
+}
+
+func isCloudInitSeedDisk(disk libvirtxml.DomainDisk) bool {
+	return disk.Device == "cdrom" && disk.Source != nil && disk.Source.File != nil && strings.HasSuffix(filepath.Base(disk.Source.File.File), cloudInitSeedSuffix)
+}
+
+// seed carries instance-id of domain it was made for, so clone must not share it
+func removeCloudInitSeedFromDomainConfig(domCfg *libvirtxml.Domain) {
+	disks := make([]libvirtxml.DomainDisk, 0, len(domCfg.Devices.Disks))
+
+	for _, disk := range domCfg.Devices.Disks {
+		if !isCloudInitSeedDisk(disk) {
+			disks = append(disks, disk)
+		}
+	}
+
+	domCfg.Devices.Disks = disks
+}
+
+func detachCloudInitSeed(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	domCfg, err := getDomainInactiveConfig(ctx, d)
+	if err != nil {
+		return "", err
+	}
+
+	for _, disk := range domCfg.Devices.Disks {
+		if !isCloudInitSeedDisk(disk) {
+			continue
+		}
+
+		path := disk.Source.File.File
+
+		devXML, err := disk.Marshal()
+		if err != nil {
+			fail.Printf("%sfailed to marshal disk XML: %s\n", id, err.Error())
+			return "", err
+		}
+
+		if isDomainActive(ctx, d) {
+			// IDE CD-ROM can not be unplugged from running domain, eject media instead
+			ejected := disk
+			ejected.Source = nil
+
+			ejectXML, err := ejected.Marshal()
+			if err != nil {
+				fail.Printf("%sfailed to marshal disk XML: %s\n", id, err.Error())
+				return "", err
+			}
+
+			err = d.UpdateDeviceFlags(ejectXML, libvirt.DOMAIN_DEVICE_MODIFY_LIVE)
+			if err != nil {
+				fail.Printf("%sfailed to eject cloud-init seed image %s: %s\n", id, path, err.Error())
+				return "", err
+			}
+			info.Printf("%sejected cloud-init seed image %s\n", id, path)
+		}
+
+		err = d.DetachDeviceFlags(devXML, libvirt.DOMAIN_DEVICE_MODIFY_CONFIG)
+		if err != nil {
+			fail.Printf("%sfailed to detach cloud-init seed image %s: %s\n", id, path, err.Error())
+			return "", err
+		}
+		info.Printf("%sdetached cloud-init seed image %s\n", id, path)
+
+		err = removeVolumeByPath(ctx, c, path)
+		if err != nil {
+			return "", err
+		}
+
+		return path, nil
+	}
+
+	fail.Printf("%sfailed to find cloud-init seed image: %s\n", id, errors.New("domain has no cloud-init seed image attached"))
+	return "", errors.New("domain has no cloud-init seed image attached")
+}
@@ -114,6 +114,11 @@ func getNumOfAssignedNodeVCPUs(ctx context.Context, c *libvirt.Connect) (uint32,
 }
 
 func isVCPUAvailable(ctx context.Context, c *libvirt.Connect, vCPU int) (bool, error) {
+	return isVCPUChangeAvailable(ctx, c, vCPU, 0)
+}
+
+// released vCPUs are already assigned to domain being changed, limits are checked only when vCPU count grows
+func isVCPUChangeAvailable(ctx context.Context, c *libvirt.Connect, vCPU int, released uint64) (bool, error) {
 	id := getReqIDFromContext(ctx)
 
 	nodeInfo, err := getNodeInfo(ctx, c)
@@ -126,11 +131,32 @@ func isVCPUAvailable(ctx context.Context, c *libvirt.Connect, vCPU int) (bool, e
 		return false, fmt.Errorf("vCPU can not be 0")
 	}
 
+	if uint64(vCPU) <= released {
+		info.Printf("%svCPU(s): %d are not increased\n", id, vCPU)
+		return true, nil
+	}
+
+	if vCPU > policy.MaxVCPUPerVM {
+		fail.Printf("%samount of vCPUs: %d are greater than allowed per domain: %d\n", id, vCPU, policy.MaxVCPUPerVM)
+		return false, fmt.Errorf("amount of vCPUs: %d are greater than allowed per domain: %d", vCPU, policy.MaxVCPUPerVM)
+	}
+
 	if uint(vCPU) > nodeInfo.Cpus {
 		fail.Printf("%samount of vCPUs: %d are greater than physically available hypervisor cores: %d\n", id, vCPU, nodeInfo.Cpus)
 		return false, fmt.Errorf("amount of vCPUs: %d are greater than physically available hypervisor cores: %d", vCPU, nodeInfo.Cpus)
 	}
 
-	info.Printf("%svCPU(s): %d available\n", id, vCPU)
+	assigned, err := getNumOfAssignedNodeVCPUs(ctx, c)
+	if err != nil {
+		return false, err
+	}
+
+	limit := uint64(float64(nodeInfo.Cpus) * policy.CPUOvercommitRatio)
+	if uint64(assigned)+uint64(vCPU)-released > limit {
+		fail.Printf("%samount of vCPUs: %d with already assigned: %d are greater than overcommit limit: %d\n", id, vCPU, assigned, limit)
+		return false, fmt.Errorf("amount of vCPUs: %d with already assigned: %d are greater than overcommit limit: %d", vCPU, assigned, limit)
+	}
+
+	info.Printf("%svCPU(s): %d available\n", id, limit-uint64(assigned))
 	return true, nil
 }
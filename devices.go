@@ -186,6 +186,10 @@ func getDomainBlockDeviceNamesOrPaths(ctx context.Context, d *libvirt.Domain, ge
 						paths = append(paths, dev.Source.File.File)
 						info.Printf("%sfound path %s in Domain XML\n", id, dev.Source.File.File)
 					}
+					if dev.Source.Block != nil {
+						paths = append(paths, dev.Source.Block.Dev)
+						info.Printf("%sfound path %s in Domain XML\n", id, dev.Source.Block.Dev)
+					}
 				}
 			}
 		}
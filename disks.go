@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// converts block IO tune values to disk XML, limits of default block IO profile are used for nil values
+func getDomainDiskIOTune(ioTune *blockIO) *libvirtxml.DomainDiskIOTune {
+	if ioTune == nil {
+		p := blockIOProfiles[defaultBlockIOProfile]
+		ioTune = &p
+	}
+
+	return &libvirtxml.DomainDiskIOTune{
+		TotalBytesSec:          ioTune.TotalBytesSec,
+		ReadBytesSec:           ioTune.ReadBytesSec,
+		WriteBytesSec:          ioTune.WriteBytesSec,
+		TotalIopsSec:           ioTune.TotalIopsSec,
+		ReadIopsSec:            ioTune.ReadIopsSec,
+		WriteIopsSec:           ioTune.WriteIopsSec,
+		TotalBytesSecMax:       ioTune.TotalBytesSecMax,
+		ReadBytesSecMax:        ioTune.ReadBytesSecMax,
+		WriteBytesSecMax:       ioTune.WriteBytesSecMax,
+		TotalIopsSecMax:        ioTune.TotalIopsSecMax,
+		ReadIopsSecMax:         ioTune.ReadIopsSecMax,
+		WriteIopsSecMax:        ioTune.WriteIopsSecMax,
+		TotalBytesSecMaxLength: ioTune.TotalBytesSecMaxLength,
+		ReadBytesSecMaxLength:  ioTune.ReadBytesSecMaxLength,
+		WriteBytesSecMaxLength: ioTune.WriteBytesSecMaxLength,
+		TotalIopsSecMaxLength:  ioTune.TotalIopsSecMaxLength,
+		ReadIopsSecMaxLength:   ioTune.ReadIopsSecMaxLength,
+		WriteIopsSecMaxLength:  ioTune.WriteIopsSecMaxLength,
+		SizeIopsSec:            ioTune.SizeIopsSec,
+		GroupName:              ioTune.GroupName,
+	}
+}
+
+// returns target device names used by persistent and, for active domain, live configuration
+func getDomainUsedDiskTargets(ctx context.Context, d *libvirt.Domain) (map[string]bool, error) {
+	id := getReqIDFromContext(ctx)
+
+	used := make(map[string]bool)
+
+	flags := []libvirt.DomainXMLFlags{libvirt.DOMAIN_XML_INACTIVE}
+	if isDomainActive(ctx, d) {
+		flags = append(flags, 0)
+	}
+
+	for _, f := range flags {
+		xml, err := getDomainXML(ctx, d, f)
+		if err != nil {
+			return nil, err
+		}
+
+		domCfg := &libvirtxml.Domain{}
+		err = domCfg.Unmarshal(xml)
+		if err != nil {
+			fail.Printf("%sfailed to parse domain XML: %s\n", id, err.Error())
+			return nil, err
+		}
+
+		if domCfg.Devices == nil {
+			continue
+		}
+
+		for _, disk := range domCfg.Devices.Disks {
+			if disk.Target != nil {
+				used[disk.Target.Dev] = true
+			}
+		}
+	}
+
+	return used, nil
+}
+
+// returns first free target device name on bus: sda, sdb, vda, ..., IDE bus has hda-hdd only
+func getDomainFreeDiskTarget(ctx context.Context, d *libvirt.Domain, bus string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	prefix, ok := specDiskBuses[bus]
+	if !ok {
+		fail.Printf("%sunknown disk bus: %s\n", id, bus)
+		return "", fmt.Errorf("unknown disk bus: %s", bus)
+	}
+
+	used, err := getDomainUsedDiskTargets(ctx, d)
+	if err != nil {
+		return "", err
+	}
+
+	for i := 0; i < specDiskBusSlots[bus]; i++ {
+		target := fmt.Sprintf("%s%c", prefix, 'a'+i)
+		if !used[target] {
+			return target, nil
+		}
+	}
+
+	fail.Printf("%sno free target device name on bus: %s, all %d are used\n", id, bus, specDiskBusSlots[bus])
+	return "", fmt.Errorf("no free target device name on bus: %s, all %d are used", bus, specDiskBusSlots[bus])
+}
+
+// device modify flags have the same values as modification impact
+func getDomainDeviceModifyFlags(ctx context.Context, d *libvirt.Domain) libvirt.DomainDeviceModifyFlags {
+	return libvirt.DomainDeviceModifyFlags(getDomainModificationImpact(ctx, d))
+}
+
+// attaches volume of storage pool as disk on first free target of bus, returns target device name
+func attachPoolVolumeToDomain(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain, pool, volume, bus, cache string, ioTune *blockIO) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	tmplDisk, err := getPoolDomainTemplateDisk(ctx, c, pool, volume, "")
+	if err != nil {
+		return "", err
+	}
+
+	target, err := getDomainFreeDiskTarget(ctx, d, bus)
+	if err != nil {
+		return "", err
+	}
+
+	_, source := getDomainDiskSource(tmplDisk)
+
+	disk := libvirtxml.DomainDisk{
+		Device: "disk",
+		Driver: &libvirtxml.DomainDiskDriver{
+			Name:         "qemu",
+			Type:         tmplDisk.Format,
+			Cache:        cache,
+			ErrorPolicy:  "enospace",
+			RErrorPolicy: "stop",
+			Discard:      "unmap",
+		},
+		Source: source,
+		Target: &libvirtxml.DomainDiskTarget{
+			Dev: target,
+			Bus: bus,
+		},
+		IOTune: getDomainDiskIOTune(ioTune),
+	}
+
+	xml, err := disk.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal disk XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	err = d.AttachDeviceFlags(xml, getDomainDeviceModifyFlags(ctx, d))
+	if err != nil {
+		fail.Printf("%sfailed to attach volume %s/%s as %s: %s\n", id, pool, volume, target, err.Error())
+		return "", err
+	}
+
+	info.Printf("%sattached volume %s/%s as %s\n", id, pool, volume, target)
+	return target, nil
+}
+
+func validateAttachDisk(bus, cache string) error {
+	problems := make([]string, 0)
+
+	if _, ok := specDiskBuses[bus]; !ok {
+		problems = append(problems, fmt.Sprintf("unknown disk bus: %s", bus))
+	}
+
+	if !isStringInSlice(cache, specDiskCacheModes) {
+		problems = append(problems, fmt.Sprintf("unknown cache mode: %s", cache))
+	}
+
+	if len(problems) != 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// attaches volume not used by any other domain, disk size is checked against quota of domain tenant
+func attachDisk(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain, pool, volume, bus, cache string, ioTune *blockIO) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	err := validateAttachDisk(bus, cache)
+	if err != nil {
+		fail.Printf("%sfailed to validate disk options: %s\n", id, err.Error())
+		return "", err
+	}
+
+	v, err := lookupPoolVolume(ctx, c, pool, volume)
+	if err != nil {
+		return "", err
+	}
+	defer freeVolume(ctx, v)
+
+	vol, err := getVolumeInfoResponse(ctx, v, nil)
+	if err != nil {
+		return "", err
+	}
+
+	users, err := getVolumeUsers(ctx, c, vol.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if len(users) != 0 {
+		fail.Printf("%svolume %s is used by domain(s): %s\n", id, vol.Path, strings.Join(users, ", "))
+		return "", fmt.Errorf("volume %s is used by domain(s): %s", vol.Path, strings.Join(users, ", "))
+	}
+
+	tenant, err := getDomainTenant(ctx, d)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkTenantQuota(ctx, c, tenant, TenantUsageResponse{DiskBytes: vol.Capacity})
+	if err != nil {
+		return "", err
+	}
+
+	return attachPoolVolumeToDomain(ctx, c, d, pool, volume, bus, cache, ioTune)
+}
+
+func findDomainDiskByTarget(domCfg *libvirtxml.Domain, target string) *libvirtxml.DomainDisk {
+	if domCfg.Devices == nil {
+		return nil
+	}
+
+	for i := range domCfg.Devices.Disks {
+		disk := &domCfg.Devices.Disks[i]
+		if disk.Device == "disk" && disk.Target != nil && disk.Target.Dev == target {
+			return disk
+		}
+	}
+
+	return nil
+}
+
+// detaches disk from live config of active domain and from persistent config, volume is left in storage pool
+func detachDisk(ctx context.Context, d *libvirt.Domain, target string) error {
+	id := getReqIDFromContext(ctx)
+
+	configs := []struct {
+		xmlFlags    libvirt.DomainXMLFlags
+		modifyFlags libvirt.DomainDeviceModifyFlags
+		enabled     bool
+	}{
+		{0, libvirt.DOMAIN_DEVICE_MODIFY_LIVE, isDomainActive(ctx, d)},
+		{libvirt.DOMAIN_XML_INACTIVE, libvirt.DOMAIN_DEVICE_MODIFY_CONFIG, isDomainPersistent(ctx, d)},
+	}
+
+	var found bool
+
+	for _, cfg := range configs {
+		if !cfg.enabled {
+			continue
+		}
+
+		xml, err := getDomainXML(ctx, d, cfg.xmlFlags)
+		if err != nil {
+			return err
+		}
+
+		domCfg := &libvirtxml.Domain{}
+		err = domCfg.Unmarshal(xml)
+		if err != nil {
+			fail.Printf("%sfailed to parse domain XML: %s\n", id, err.Error())
+			return err
+		}
+
+		disk := findDomainDiskByTarget(domCfg, target)
+		if disk == nil {
+			continue
+		}
+
+		found = true
+
+		devXML, err := disk.Marshal()
+		if err != nil {
+			fail.Printf("%sfailed to marshal disk XML: %s\n", id, err.Error())
+			return err
+		}
+
+		err = d.DetachDeviceFlags(devXML, cfg.modifyFlags)
+		if err != nil {
+			fail.Printf("%sfailed to detach disk %s: %s\n", id, target, err.Error())
+			return err
+		}
+	}
+
+	if !found {
+		fail.Printf("%sfailed to find disk %s in domain XML\n", id, target)
+		return fmt.Errorf("failed to find disk %s in domain XML", target)
+	}
+
+	info.Printf("%sdetached disk %s\n", id, target)
+	return nil
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/libvirt/libvirt-go"
 	libvirtxml "github.com/libvirt/libvirt-go-xml"
@@ -17,6 +17,11 @@ const (
 	domainAffectConfig  = "DOMAIN_AFFECT_CONFIG"
 	domainAffectLive    = "DOMAIN_AFFECT_LIVE"
 	domainAffectCurrent = "DOMAIN_AFFECT_CURRENT"
+
+	domainShutdownGuestAgent   = "DOMAIN_SHUTDOWN_GUEST_AGENT"
+	domainShutdownACPIPowerBtn = "DOMAIN_SHUTDOWN_ACPI_POWER_BTN"
+	domainDestroyGraceful      = "DOMAIN_DESTROY_GRACEFUL"
+	domainDestroyDefault       = "DOMAIN_DESTROY_DEFAULT"
 )
 
 // https://libvirt.org/formatdomain.html
@@ -65,6 +70,45 @@ func destroyAndUndefineDomain(ctx context.Context, c *libvirt.Connect, d *libvir
 	return true, nil
 }
 
+func defineDomain(ctx context.Context, c *libvirt.Connect, xml string) (*libvirt.Domain, error) {
+	id := getReqIDFromContext(ctx)
+
+	d, err := c.DomainDefineXMLFlags(xml, libvirt.DOMAIN_DEFINE_VALIDATE)
+	if err != nil {
+		fail.Printf("%sfailed to define domain using XML: %s\n", id, err.Error())
+		return nil, err
+	}
+
+	info.Printf("%sdefined domain using XML\n", id)
+	return d, nil
+}
+
+func undefineDomain(ctx context.Context, d *libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+	id := getReqIDFromContext(ctx)
+
+	err := d.UndefineFlags(flags)
+	if err != nil {
+		fail.Printf("%sfailed to undefine domain: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sdomain undefined\n", id)
+	return nil
+}
+
+func getDomainXML(ctx context.Context, d *libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	xmlDoc, err := d.GetXMLDesc(flags)
+	if err != nil {
+		fail.Printf("%sfailed to get domain XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	info.Printf("%sacquired domain XML\n", id)
+	return xmlDoc, nil
+}
+
 func listAllDomainsWithFlags(ctx context.Context, c *libvirt.Connect, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, error) {
 	id := getReqIDFromContext(ctx)
 
@@ -137,7 +181,7 @@ func lookupDomainByName(ctx context.Context, c *libvirt.Connect, domain string)
 	return d, nil
 }
 
-func destroyDomain(ctx context.Context, d *libvirt.Domain, flags libvirt.DomainDestroyFlags) error {
+func deleteDomain(ctx context.Context, d *libvirt.Domain, flags libvirt.DomainDestroyFlags, keepDisks, skipBackup bool) error {
 	id := getReqIDFromContext(ctx)
 
 	c, err := getConnectFromDomain(ctx, d)
@@ -151,10 +195,12 @@ func destroyDomain(ctx context.Context, d *libvirt.Domain, flags libvirt.DomainD
 		return err
 	}
 
-	for _, path := range paths {
-		err := createBackup(ctx, c, path)
-		if err != nil {
-			return err
+	if !skipBackup {
+		for _, path := range paths {
+			err := createBackup(ctx, c, path)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -163,6 +209,11 @@ func destroyDomain(ctx context.Context, d *libvirt.Domain, flags libvirt.DomainD
 		return err
 	}
 
+	if keepDisks {
+		info.Printf("%sdeleted domain, disks are kept\n", id)
+		return nil
+	}
+
 	pools, err := listStorgePools(ctx, c, libvirt.CONNECT_LIST_STORAGE_POOLS_ACTIVE|libvirt.CONNECT_LIST_STORAGE_POOLS_PERSISTENT)
 	defer freePools(ctx, pools)
 	if err != nil {
@@ -206,12 +257,12 @@ func destroyDomain(ctx context.Context, d *libvirt.Domain, flags libvirt.DomainD
 	for _, path := range paths {
 		v, err := lookupStorageVolByPath(ctx, c, path)
 		if err == nil {
-			fail.Printf("%sfailed to remove volume %s: %s\n", id, path, err.Error())
+			fail.Printf("%sfailed to remove volume %s: %s\n", id, path, errors.New("volume still exists"))
 			freeVolume(ctx, v)
 		}
 	}
 
-	info.Printf("%sdestroyed domain\n", id)
+	info.Printf("%sdeleted domain\n", id)
 	return nil
 }
 
@@ -254,6 +305,111 @@ func shutdownDomain(ctx context.Context, d *libvirt.Domain, flag libvirt.DomainS
 	return nil
 }
 
+// polls domain state every second, waiting stops on timeout or when request context is done
+func waitDomainInactive(ctx context.Context, d *libvirt.Domain, timeout time.Duration) bool {
+	id := getReqIDFromContext(ctx)
+
+	t := time.Now()
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if !isDomainActive(ctx, d) {
+			info.Printf("%sdomain became inactive after %v\n", id, time.Since(t))
+			return true
+		}
+
+		if time.Since(t) >= timeout {
+			info.Printf("%sstopped waiting for domain to become inactive, timeout exceeded\n", id)
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			info.Printf("%sstopped waiting for domain to become inactive: %s\n", id, ctx.Err().Error())
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+func powerOffDomain(ctx context.Context, d *libvirt.Domain) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	err := d.DestroyFlags(libvirt.DOMAIN_DESTROY_GRACEFUL)
+	if err == nil {
+		info.Printf("%sdomain powered off gracefully\n", id)
+		return domainDestroyGraceful, nil
+	}
+
+	fail.Printf("%sfailed to power off domain gracefully: %s\n", id, err.Error())
+
+	err = d.DestroyFlags(libvirt.DOMAIN_DESTROY_DEFAULT)
+	if err != nil {
+		fail.Printf("%sfailed to power off domain: %s\n", id, err.Error())
+		return "", err
+	}
+
+	info.Printf("%sdomain powered off forcefully\n", id)
+	return domainDestroyDefault, nil
+}
+
+func shutdownDomainAndWait(ctx context.Context, d *libvirt.Domain, timeout time.Duration, force bool) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	deadline := time.Now().Add(timeout)
+
+	// method of last successfully sent shutdown request, reported when domain stops after its wait is over
+	var method string
+
+	if isGuestAgentAvailable(ctx, d) {
+		err := shutdownDomain(ctx, d, libvirt.DOMAIN_SHUTDOWN_GUEST_AGENT)
+		if err == nil {
+			method = domainShutdownGuestAgent
+
+			if waitDomainInactive(ctx, d, timeout/2) {
+				return method, nil
+			}
+		}
+	}
+
+	// canceled request must not escalate to ACPI or power off
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	// guest agent shutdown may finish right after its wait, ACPI request would fail on inactive domain
+	if len(method) != 0 && !isDomainActive(ctx, d) {
+		return method, nil
+	}
+
+	err := shutdownDomain(ctx, d, libvirt.DOMAIN_SHUTDOWN_ACPI_POWER_BTN)
+	if err == nil {
+		method = domainShutdownACPIPowerBtn
+
+		if waitDomainInactive(ctx, d, time.Until(deadline)) {
+			return method, nil
+		}
+	}
+
+	// domain may also stop on its own while both shutdown requests fail, method is empty then
+	if !isDomainActive(ctx, d) {
+		return method, nil
+	}
+
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	if !force {
+		fail.Printf("%sdomain did not shutdown in %v\n", id, timeout)
+		return "", fmt.Errorf("domain did not shutdown in %v", timeout)
+	}
+
+	return powerOffDomain(ctx, d)
+}
+
 func rebootDomain(ctx context.Context, d *libvirt.Domain, flag libvirt.DomainRebootFlagValues) error {
 	id := getReqIDFromContext(ctx)
 
@@ -267,6 +423,123 @@ func rebootDomain(ctx context.Context, d *libvirt.Domain, flag libvirt.DomainReb
 	return nil
 }
 
+func suspendDomain(ctx context.Context, d *libvirt.Domain) error {
+	id := getReqIDFromContext(ctx)
+
+	err := d.Suspend()
+	if err != nil {
+		fail.Printf("%sfailed to suspend domain: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%ssuspended domain\n", id)
+	return nil
+}
+
+func resumeDomain(ctx context.Context, d *libvirt.Domain) error {
+	id := getReqIDFromContext(ctx)
+
+	err := d.Resume()
+	if err != nil {
+		fail.Printf("%sfailed to resume domain: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sresumed domain\n", id)
+	return nil
+}
+
+func managedSaveDomain(ctx context.Context, d *libvirt.Domain, flags libvirt.DomainSaveRestoreFlags) error {
+	id := getReqIDFromContext(ctx)
+
+	err := d.ManagedSave(flags)
+	if err != nil {
+		fail.Printf("%sfailed to save domain state to managed save image: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%ssaved domain state to managed save image\n", id)
+	return nil
+}
+
+func isDomainHasManagedSaveImage(ctx context.Context, d *libvirt.Domain) bool {
+	id := getReqIDFromContext(ctx)
+
+	s, err := d.HasManagedSaveImage(0)
+	if err != nil {
+		fail.Printf("%sfailed to get managed save image status for domain: %s\n", id, err.Error())
+		return false
+	}
+
+	info.Printf("%sacquired managed save image status for domain\n", id)
+	return s
+}
+
+func removeDomainManagedSaveImage(ctx context.Context, d *libvirt.Domain) error {
+	id := getReqIDFromContext(ctx)
+
+	err := d.ManagedSaveRemove(0)
+	if err != nil {
+		fail.Printf("%sfailed to remove managed save image of domain: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sremoved managed save image of domain\n", id)
+	return nil
+}
+
+func saveDomain(ctx context.Context, d *libvirt.Domain, path string, flags libvirt.DomainSaveRestoreFlags) error {
+	id := getReqIDFromContext(ctx)
+
+	err := d.SaveFlags(path, "", flags)
+	if err != nil {
+		fail.Printf("%sfailed to save domain state to %s: %s\n", id, path, err.Error())
+		return err
+	}
+
+	info.Printf("%ssaved domain state to %s\n", id, path)
+	return nil
+}
+
+func restoreDomain(ctx context.Context, c *libvirt.Connect, path string, flags libvirt.DomainSaveRestoreFlags) error {
+	id := getReqIDFromContext(ctx)
+
+	err := c.DomainRestoreFlags(path, "", flags)
+	if err != nil {
+		fail.Printf("%sfailed to restore domain state from %s: %s\n", id, path, err.Error())
+		return err
+	}
+
+	info.Printf("%srestored domain state from %s\n", id, path)
+	return nil
+}
+
+func getDomainNameFromSaveImage(ctx context.Context, c *libvirt.Connect, path string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	xmlDoc, err := c.DomainSaveImageGetXMLDesc(path, 0)
+	if err != nil {
+		fail.Printf("%sfailed to get domain XML from save image %s: %s\n", id, path, err.Error())
+		return "", err
+	}
+	info.Printf("%sacquired domain XML from save image %s\n", id, path)
+
+	domCfg := &libvirtxml.Domain{}
+	err = domCfg.Unmarshal(xmlDoc)
+	if err != nil {
+		fail.Printf("%sfailed to parse domain XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	if len(domCfg.Name) == 0 {
+		fail.Printf("%sfailed to get domain name from save image %s: %s\n", id, path, errors.New("empty domain name in XML"))
+		return "", errors.New("empty domain name in XML")
+	}
+
+	info.Printf("%sacquired domain name %s from save image %s\n", id, domCfg.Name, path)
+	return domCfg.Name, nil
+}
+
 func freeDomains(ctx context.Context, d []libvirt.Domain) {
 	id := getReqIDFromContext(ctx)
 
@@ -407,19 +680,15 @@ func getNewDomainImageName(ctx context.Context, c *libvirt.Connect, domainName,
 	}
 	defer freePool(ctx, pool)
 
-	poolPath, err := getPoolPath(ctx, pool)
-	if err != nil {
-		return "", err
-	}
+	imageName := getDomainDiskImageName(domainName, 0, "")
 
-	imagePath := filepath.Clean(fmt.Sprintf("%s/%s.qcow2", poolPath, domainName))
-	vol, err := lookupStorageVolByPath(ctx, c, imagePath)
+	vol, err := pool.LookupStorageVolByName(imageName)
 	if err == nil {
 		defer freeVolume(ctx, vol)
-		return "", fmt.Errorf("image: %s exists", imagePath)
+		return "", fmt.Errorf("image: %s exists in storage %s", imageName, storagePoolName)
 	}
 
-	return imagePath, nil
+	return getPoolFilePath(ctx, c, storagePoolName, imageName)
 }
 
 func isDomainNameValidAndAvailable(ctx context.Context, c *libvirt.Connect, name string) (bool, error) {
@@ -451,203 +720,72 @@ func isDomainNameValidAndAvailable(ctx context.Context, c *libvirt.Connect, name
 	return true, nil
 }
 
-func prepareXMLforNewDomain(ctx context.Context, c *libvirt.Connect, uuid, name string, vCPU, maxVCPUs int, memory, maxMemory uint, storagePool, network, mac string, vlan uint) (string, error) {
+// renders domain template without disks and network interfaces
+func getNewDomainBaseConfig(ctx context.Context, templateName, uuid, name string, vCPU, maxVCPUs int, memory, maxMemory uint) (*libvirtxml.Domain, error) {
 	id := getReqIDFromContext(ctx)
 
-	imagePath, err := getNewDomainImageName(ctx, c, name, storagePool)
+	domCfg, err := renderDomainTemplate(ctx, templateName, DomainTemplateVars{
+		UUID:      uuid,
+		Name:      name,
+		VCPU:      vCPU,
+		MaxVCPU:   maxVCPUs,
+		Memory:    memory,
+		MaxMemory: maxMemory,
+	})
 	if err != nil {
-		fail.Printf("%sfailed to allocate name for domain image: %s\n", id, err.Error())
-		return "", err
+		return nil, err
 	}
 
-	info.Printf("%sallocated name for domain image: %s\n", id, imagePath)
-
-	xml := `
-    <domain type='kvm'>
-    <name>TEMPLATE</name>
-    <uuid>0d15ea5e-dead-dead-dead-defec8eddead</uuid>
-    <metadata>
-      <my:custom xmlns:my="1c5537ac-8c84-4313-a8e7-9dd8d45ac7ed">
-        <my:network type="max_tx_rate">100</my:network>
-        <my:network type="trust">off</my:network>
-        <my:network type="spoofchk">on</my:network>
-        <my:network type="query_rss">off</my:network>
-        <my:network type="qos">0</my:network>
-      </my:custom>
-    </metadata>
-    <memory unit='KiB'>10240</memory>
-    <currentMemory unit='KiB'>10240</currentMemory>
-    <vcpu placement='static' current='1'>1</vcpu>
-    <cputune>
-      <shares>1024</shares>
-    </cputune>
-    <sysinfo type='smbios'>
-      <bios>
-        <entry name='vendor'>KVM</entry>
-      </bios>
-      <system>
-        <entry name='manufacturer'>KVM</entry>
-        <entry name='product'>VM</entry>
-      </system>
-      <baseBoard>
-        <entry name='manufacturer'>KVM</entry>
-        <entry name='product'>VM</entry>
-      </baseBoard>
-    </sysinfo>
-    <os>
-      <type arch='x86_64'>hvm</type>
-      <boot dev='hd'/>
-      <smbios mode='sysinfo'/>
-    </os>
-    <features>
-      <acpi/>
-      <apic/>
-    </features>
-    <cpu mode='host-model' check='partial'>
-      <model fallback='allow'/>
-    </cpu>
-    <clock offset='utc'>
-      <timer name='rtc' tickpolicy='catchup'/>
-      <timer name='pit' tickpolicy='delay'/>
-      <timer name='hpet' present='no'/>
-    </clock>
-    <on_poweroff>destroy</on_poweroff>
-    <on_reboot>restart</on_reboot>
-    <on_crash>restart</on_crash>
-    <pm>
-      <suspend-to-mem enabled='yes'/>
-      <suspend-to-disk enabled='no'/>
-    </pm>
-    <devices>
-      <emulator>/usr/bin/kvm-spice</emulator>
-      <controller type='scsi' index='0' model='virtio-scsi'/>
-      <controller type='usb' index='0' model='ich9-ehci1'/>
-      <controller type='usb' index='0' model='ich9-uhci1'>
-        <master startport='0'/>
-      </controller>
-      <controller type='pci' index='0' model='pci-root'/>
-      <controller type='ide' index='0'/>
-      <controller type='virtio-serial' index='0'/>
-      <serial type='pty'>
-        <target port='0'/>
-      </serial>
-      <console type='pty'>
-        <target type='serial' port='0'/>
-      </console>
-      <channel type='unix'>
-        <target type='virtio' name='org.qemu.guest_agent.0'/>
-      </channel>
-      <input type='keyboard' bus='virtio'/>
-      <input type='mouse' bus='virtio'/>
-      <memballoon model='virtio'>
-        <stats period='3'/>
-      </memballoon>
-    </devices>
-	</domain>`
-
-	domCfg := &libvirtxml.Domain{}
-	err = domCfg.Unmarshal(xml)
-	if err != nil {
-		fail.Printf("%sfailed to unmarshal domain XML: %s\n", id, err.Error())
-		return "", err
+	if domCfg.Devices == nil {
+		fail.Printf("%sfailed to unmarshal domain XML: %s\n", id, errors.New("domain xml device section is empty"))
+		return nil, errors.New("domain xml device section is empty")
 	}
 
-	domCfg.Name = name
-	domCfg.UUID = uuid
+	return domCfg, nil
+}
 
-	if domCfg.Memory != nil {
-		domCfg.Memory.Value = maxMemory
-	}
+func prepareXMLforNewDomain(ctx context.Context, c *libvirt.Connect, uuid, name string, vCPU, maxVCPUs int, memory, maxMemory uint, storagePool, imageTemplate, network, mac string, vlan uint) (string, error) {
+	id := getReqIDFromContext(ctx)
 
-	if domCfg.CurrentMemory != nil {
-		domCfg.CurrentMemory.Value = memory
+	imagePath, err := getNewDomainImageName(ctx, c, name, storagePool)
+	if err != nil {
+		fail.Printf("%sfailed to allocate name for domain image: %s\n", id, err.Error())
+		return "", err
 	}
 
-	if domCfg.VCPU != nil {
-		domCfg.VCPU.Current = uint(vCPU)
-		domCfg.VCPU.Value = uint(maxVCPUs)
-	}
+	info.Printf("%sallocated name for domain image: %s\n", id, imagePath)
 
-	if domCfg.Devices != nil {
-		/*
-			<disk type='file' device='disk'>
-				<driver name='qemu' type='qcow2' cache='directsync' error_policy='enospace' rerror_policy='stop' discard='unmap'/>
-				<source file='/var/lib/libvirt/images/ubuntu-16.04.qcow2'/>
-				<target dev='sda' bus='scsi'/>
-				<iotune>
-					<read_iops_sec>1000</read_iops_sec>
-					<write_iops_sec>400</write_iops_sec>
-					<read_iops_sec_max>1100</read_iops_sec_max>
-					<write_iops_sec_max>450</write_iops_sec_max>
-					<read_iops_sec_max_length>15</read_iops_sec_max_length>
-					<write_iops_sec_max_length>5</write_iops_sec_max_length>
-				</iotune>
-			</disk>
-		*/
-		domCfg.Devices.Disks = []libvirtxml.DomainDisk{
-			{
-				Device: "disk",
-				Driver: &libvirtxml.DomainDiskDriver{
-					Name:         "qemu",
-					Type:         "qcow2",
-					Cache:        "directsync",
-					ErrorPolicy:  "enospace",
-					RErrorPolicy: "stop",
-					Discard:      "unmap",
-				},
-				Source: &libvirtxml.DomainDiskSource{
-					File: &libvirtxml.DomainDiskSourceFile{
-						File: imagePath,
-					},
-				},
-				Target: &libvirtxml.DomainDiskTarget{
-					Dev: "sda",
-					Bus: "scsi",
-				},
-				IOTune: &libvirtxml.DomainDiskIOTune{
-					ReadIopsSec:           1000,
-					WriteIopsSec:          400,
-					ReadIopsSecMax:        1100,
-					WriteIopsSecMax:       450,
-					ReadIopsSecMaxLength:  15,
-					WriteIopsSecMaxLength: 5,
-				},
-			},
-		}
+	disk, err := getPoolDomainTemplateDisk(ctx, c, storagePool, getDomainDiskImageName(name, 0, ""), imageTemplate)
+	if err != nil {
+		return "", err
 	}
 
-	if domCfg.Devices != nil {
-		/*
-			<interface type="network">
-				<mac address="52:54:00:ff:ff:ff"></mac>
-				<source network="pf-enp6s2f2"></source>
-				<vlan>
-					<tag id="222"></tag>
-				</vlan>
-			</interface>
-		*/
-		domCfg.Devices.Interfaces = []libvirtxml.DomainInterface{
+	disk.Target = "sda"
+	disk.Bus = "scsi"
+
+	domCfg, err := renderDomainTemplate(ctx, defaultDomainTemplate, DomainTemplateVars{
+		UUID:      uuid,
+		Name:      name,
+		VCPU:      vCPU,
+		MaxVCPU:   maxVCPUs,
+		Memory:    memory,
+		MaxMemory: maxMemory,
+		Disks: []DomainTemplateDisk{
+			disk,
+		},
+		NICs: []DomainTemplateNIC{
 			{
-				MAC: &libvirtxml.DomainInterfaceMAC{
-					Address: mac,
-				},
-				Source: &libvirtxml.DomainInterfaceSource{
-					Network: &libvirtxml.DomainInterfaceSourceNetwork{
-						Network: network,
-					},
-				},
-				VLan: &libvirtxml.DomainInterfaceVLan{
-					Tags: []libvirtxml.DomainInterfaceVLanTag{
-						{
-							ID: vlan,
-						},
-					},
-				},
+				MAC:     mac,
+				Network: network,
+				VLAN:    vlan,
 			},
-		}
+		},
+	})
+	if err != nil {
+		return "", err
 	}
 
-	xml, err = domCfg.Marshal()
+	xml, err := domCfg.Marshal()
 	if err != nil {
 		fail.Printf("%sfailed to marshal domain XML: %s\n", id, err.Error())
 		return "", err
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/semrush/zenrpc"
+)
+
+/* global variable declaration, if any... */
+const idempotencyKeyHeader = "Idempotency-Key"
+
+var idemStore *idempotencyStore
+
+// read-only methods are served without idempotency key handling, retry of them is always safe
+var idempotencyReadOnlyMethods = map[string]bool{
+	RPC.JRPCService.Ping:                true,
+	RPC.JRPCService.GenUUID:             true,
+	RPC.JRPCService.GenMAC:              true,
+	RPC.JRPCService.ListLocks:           true,
+	RPC.JRPCService.HypervisorInfo:      true,
+	RPC.JRPCService.Info:                true,
+	RPC.JRPCService.BulkInfo:            true,
+	RPC.JRPCService.GetLabels:           true,
+	RPC.JRPCService.QemuAgentInfo:       true,
+	RPC.JRPCService.Domains:             true,
+	RPC.JRPCService.ListBlockIOProfiles: true,
+	RPC.JRPCService.FindOrphans:         true,
+	RPC.JRPCService.GetImportJob:        true,
+	RPC.JRPCService.ListImportJobs:      true,
+	RPC.JRPCService.ListPools:           true,
+	RPC.JRPCService.ListImageTemplates:  true,
+	RPC.JRPCService.ListVolumes:         true,
+	RPC.JRPCService.VolumeInfo:          true,
+	RPC.JRPCService.ListTemplates:       true,
+	RPC.JRPCService.RenderTemplate:      true,
+	RPC.JRPCService.PlanCreate:          true,
+	RPC.JRPCService.TenantUsage:         true,
+	RPC.JRPCService.GetXML:              true,
+	RPC.JRPCService.GetAdmissionPolicy:  true,
+	RPC.JRPCService.CheckResources:      true,
+}
+
+type idempotencyRecord struct {
+	Method     string           `json:"Method"`
+	ParamsHash string           `json:"ParamsHash"`
+	Result     *json.RawMessage `json:"Result,omitempty"`
+	Error      *zenrpc.Error    `json:"Error,omitempty"`
+	Created    time.Time        `json:"Created"`
+}
+
+// completed results are kept on disk for window, keys of running requests only in memory
+type idempotencyStore struct {
+	mu       sync.Mutex
+	path     string
+	window   time.Duration
+	records  map[string]idempotencyRecord
+	inFlight map[string]bool
+}
+
+func newIdempotencyStore(path string, window time.Duration) (*idempotencyStore, error) {
+	s := &idempotencyStore{
+		path:     path,
+		window:   window,
+		records:  make(map[string]idempotencyRecord),
+		inFlight: make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(data) != 0 {
+		err = json.Unmarshal(data, &s.records)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse idempotency store %s: %s", path, err.Error())
+		}
+	}
+
+	s.expire()
+
+	return s, nil
+}
+
+func (s *idempotencyStore) expire() {
+	for key, rec := range s.records {
+		if time.Since(rec.Created) > s.window {
+			delete(s.records, key)
+		}
+	}
+}
+
+func (s *idempotencyStore) save() error {
+	data, err := json.Marshal(s.records)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0o700)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// begin returns stored record for completed request or marks key as running
+func (s *idempotencyStore) begin(key, method, paramsHash string) (*idempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+
+	if rec, ok := s.records[key]; ok {
+		if rec.Method != method || rec.ParamsHash != paramsHash {
+			return nil, fmt.Errorf("idempotency key %s was already used with different request", key)
+		}
+
+		return &rec, nil
+	}
+
+	if s.inFlight[key] {
+		return nil, fmt.Errorf("request with idempotency key %s is still in process", key)
+	}
+
+	s.inFlight[key] = true
+
+	return nil, nil
+}
+
+// finish releases key of running request, nil record (request did not complete) is not stored, so request can be retried with the same key
+func (s *idempotencyStore) finish(key string, rec *idempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inFlight, key)
+
+	if rec == nil {
+		return nil
+	}
+
+	s.records[key] = *rec
+
+	return s.save()
+}
+
+func getParamsHash(params json.RawMessage) string {
+	var b bytes.Buffer
+
+	err := json.Compact(&b, params)
+	if err != nil {
+		b.Reset()
+		b.Write(params)
+	}
+
+	sum := sha256.Sum256(b.Bytes())
+
+	return hex.EncodeToString(sum[:])
+}
+
+// mutating requests with Idempotency-Key header return original outcome, result or error, when retried with the same key
+func idempotencyChecker() zenrpc.MiddlewareFunc {
+	return func(h zenrpc.InvokeFunc) zenrpc.InvokeFunc {
+		return func(ctx context.Context, method string, params json.RawMessage) zenrpc.Response {
+			req, ok := zenrpc.RequestFromContext(ctx)
+			if !ok || req == nil || idemStore == nil {
+				return h(ctx, method, params)
+			}
+
+			key := req.Header.Get(idempotencyKeyHeader)
+			if len(key) == 0 || idempotencyReadOnlyMethods[method] {
+				return h(ctx, method, params)
+			}
+
+			id := getReqIDFromContext(ctx)
+			name := fmt.Sprintf("%s.%s", zenrpc.NamespaceFromContext(ctx), method)
+
+			rec, err := idemStore.begin(key, name, getParamsHash(params))
+			if err != nil {
+				fail.Printf("%s%s\n", id, err.Error())
+				return zenrpc.NewResponseError(nil, zenrpc.InvalidRequest, err.Error(), nil)
+			}
+
+			if rec != nil {
+				info.Printf("%sreturning stored outcome for idempotency key %s\n", id, key)
+				return zenrpc.Response{
+					Version: zenrpc.Version,
+					Result:  rec.Result,
+					Error:   rec.Error,
+				}
+			}
+
+			var (
+				r         zenrpc.Response
+				completed bool
+			)
+
+			// key is released even if handler panics
+			defer func() {
+				var rec *idempotencyRecord
+
+				// error is replayed too, request with the same key never runs twice
+				if completed {
+					rec = &idempotencyRecord{
+						Method:     name,
+						ParamsHash: getParamsHash(params),
+						Result:     r.Result,
+						Error:      r.Error,
+						Created:    time.Now(),
+					}
+				}
+
+				err := idemStore.finish(key, rec)
+				if err != nil {
+					fail.Printf("%sfailed to save outcome for idempotency key %s: %s\n", id, key, err.Error())
+				}
+			}()
+
+			r = h(ctx, method, params)
+			completed = true
+
+			return r
+		}
+	}
+}
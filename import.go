@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libvirt/libvirt-go"
+)
+
+/* global variable declaration, if any... */
+const (
+	importJobRunning   = "running"
+	importJobCompleted = "completed"
+	importJobFailed    = "failed"
+)
+
+var (
+	importFormats = []string{"raw", "qcow2", "vmdk", "vhdx", "vpc", "vdi"}
+
+	// qemu-img convert -p reports progress as "    (12.34/100%)" separated by carriage returns
+	importProgressRegexp = regexp.MustCompile(`\((\d+(?:\.\d+)?)/100%\)`)
+
+	importJobs sync.Map // job ID -> *importJob, jobs are kept in memory until restart
+)
+
+type importJob struct {
+	mu     sync.Mutex
+	status ImportJobStatus
+}
+
+func (j *importJob) get() ImportJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.status
+}
+
+func (j *importJob) update(fn func(s *ImportJobStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	fn(&j.status)
+}
+
+func (j *importJob) finish(err error) {
+	j.update(func(s *ImportJobStatus) {
+		s.Finished = time.Now().UTC().Format(time.RFC3339)
+
+		if err != nil {
+			s.State = importJobFailed
+			s.Error = err.Error()
+			return
+		}
+
+		s.State = importJobCompleted
+		s.Progress = 100
+	})
+}
+
+// returns <pool>/<volume> of targets of running import jobs
+func getRunningImportTargets() map[string]bool {
+	targets := make(map[string]bool)
+
+	importJobs.Range(func(_, v interface{}) bool {
+		s := v.(*importJob).get()
+		if s.State == importJobRunning {
+			targets[s.Pool+"/"+s.TargetName] = true
+		}
+
+		return true
+	})
+
+	return targets
+}
+
+// local source must be inside import directory, symbolic links are resolved before check
+func resolveImportFile(ctx context.Context, source string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	if len(*importDir) == 0 {
+		fail.Printf("%simport from local files is disabled, source should be <pool>/<volume>: %s\n", id, source)
+		return "", fmt.Errorf("import from local files is disabled, source should be <pool>/<volume>: %s", source)
+	}
+
+	dir, err := filepath.EvalSymlinks(*importDir)
+	if err != nil {
+		fail.Printf("%sfailed to access import directory %s: %s\n", id, *importDir, err.Error())
+		return "", err
+	}
+
+	path, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		fail.Printf("%sfailed to access import source %s: %s\n", id, source, err.Error())
+		return "", err
+	}
+
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		fail.Printf("%simport source %s is outside of import directory %s\n", id, source, *importDir)
+		return "", fmt.Errorf("import source %s is outside of import directory %s", source, *importDir)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		fail.Printf("%sfailed to access import source %s: %s\n", id, source, err.Error())
+		return "", err
+	}
+
+	if !fi.Mode().IsRegular() {
+		fail.Printf("%simport source %s is not regular file\n", id, source)
+		return "", fmt.Errorf("import source %s is not regular file", source)
+	}
+
+	return path, nil
+}
+
+// source is file inside import directory (absolute path) or volume of storage pool (<pool>/<volume>), e.g. uploaded over HTTP
+func resolveImportSource(ctx context.Context, c *libvirt.Connect, source string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	if filepath.IsAbs(source) {
+		return resolveImportFile(ctx, source)
+	}
+
+	parts := strings.SplitN(source, "/", 2)
+	if len(parts) != 2 {
+		fail.Printf("%simport source should be absolute path or <pool>/<volume>: %s\n", id, source)
+		return "", fmt.Errorf("import source should be absolute path or <pool>/<volume>: %s", source)
+	}
+
+	v, err := lookupPoolVolume(ctx, c, parts[0], parts[1])
+	if err != nil {
+		return "", err
+	}
+	defer freeVolume(ctx, v)
+
+	return getVolumePath(ctx, v)
+}
+
+func validateImportDisk(ctx context.Context, c *libvirt.Connect, pool, format, target, domain string) error {
+	problems := make([]string, 0)
+
+	poolType, err := getPoolType(ctx, c, pool)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else if !isPoolFileBased(poolType) {
+		problems = append(problems, fmt.Sprintf("import requires file based storage pool, %s is %s pool", pool, poolType))
+	}
+
+	if !isStringInSlice(format, importFormats) {
+		problems = append(problems, fmt.Sprintf("not supported source format %s, supported: %s", format, strings.Join(importFormats, ", ")))
+	}
+
+	if len(target) == 0 || strings.Contains(target, "/") {
+		problems = append(problems, fmt.Sprintf("not valid target volume name: %s", target))
+	} else if v, err := lookupPoolVolume(ctx, c, pool, target); err == nil {
+		freeVolume(ctx, v)
+		problems = append(problems, fmt.Sprintf("volume %s/%s already exists", pool, target))
+	}
+
+	if len(domain) != 0 {
+		d, err := lookupDomainByName(ctx, c, domain)
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			freeDomain(ctx, d)
+		}
+	}
+
+	if len(problems) != 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// splits qemu-img progress output on carriage returns as well as on new lines
+func scanProgressLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF && len(data) != 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+func convertDiskImage(ctx context.Context, job *importJob, source, format, target string) error {
+	id := getReqIDFromContext(ctx)
+
+	cmd := exec.CommandContext(ctx, "qemu-img", "convert", "-p", "-f", format, "-O", volumeFormatQcow2, source, target)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		fail.Printf("%sfailed to start qemu-img convert: %s\n", id, err.Error())
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(scanProgressLines)
+
+	for scanner.Scan() {
+		m := importProgressRegexp.FindSubmatch(scanner.Bytes())
+		if m == nil {
+			continue
+		}
+
+		if p, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+			job.update(func(s *ImportJobStatus) { s.Progress = p })
+		}
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		fail.Printf("%sfailed to convert %s to %s: %s, output: %s\n", id, source, target, err.Error(), strings.TrimSpace(stderr.String()))
+		return fmt.Errorf("failed to convert %s: %s", source, strings.TrimSpace(stderr.String()))
+	}
+
+	info.Printf("%sconverted %s (%s) to %s\n", id, source, format, target)
+	return nil
+}
+
+func getImageVirtualSize(ctx context.Context, path, format string) (uint64, error) {
+	out, err := exec.CommandContext(ctx, "qemu-img", "info", "--output=json", "-f", format, path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get image info of %s: %s", path, err.Error())
+	}
+
+	var imgInfo struct {
+		VirtualSize uint64 `json:"virtual-size"`
+	}
+
+	err = json.Unmarshal(out, &imgInfo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse image info of %s: %s", path, err.Error())
+	}
+
+	return imgInfo.VirtualSize, nil
+}
+
+// checks qcow2 metadata of converted image and compares its virtual size with source
+func validateConvertedImage(ctx context.Context, source, format, target string) error {
+	id := getReqIDFromContext(ctx)
+
+	out, err := exec.CommandContext(ctx, "qemu-img", "check", "-f", volumeFormatQcow2, target).CombinedOutput()
+	if err != nil {
+		fail.Printf("%sconverted image %s is not consistent: %s\n", id, target, strings.TrimSpace(string(out)))
+		return fmt.Errorf("converted image %s is not consistent: %s", target, strings.TrimSpace(string(out)))
+	}
+
+	srcSize, err := getImageVirtualSize(ctx, source, format)
+	if err != nil {
+		return err
+	}
+
+	dstSize, err := getImageVirtualSize(ctx, target, volumeFormatQcow2)
+	if err != nil {
+		return err
+	}
+
+	if srcSize != dstSize {
+		fail.Printf("%sconverted image %s has virtual size %d, source has %d\n", id, target, dstSize, srcSize)
+		return fmt.Errorf("converted image %s has virtual size %d, source has %d", target, dstSize, srcSize)
+	}
+
+	info.Printf("%sconverted image %s is valid\n", id, target)
+	return nil
+}
+
+// removes target volume reserved for failed import
+func removeImportTarget(ctx context.Context, c *libvirt.Connect, p *libvirt.StoragePool, target, path string) {
+	id := getReqIDFromContext(ctx)
+
+	// qemu-img recreated file under volume known to libvirt
+	if err := refreshPool(ctx, p); err != nil {
+		fail.Printf("%sfailed to refresh pool before removing %s: %s\n", id, path, err.Error())
+	}
+
+	v, err := lookupStorageVolByName(ctx, c, p, target)
+	if err == nil {
+		defer freeVolume(ctx, v)
+
+		err = deletePoolVolume(ctx, v, libvirt.STORAGE_VOL_DELETE_NORMAL)
+	}
+
+	if err != nil {
+		fail.Printf("%sfailed to remove %s after failed import: %s\n", id, path, err.Error())
+	}
+}
+
+func runImportJob(ctx context.Context, job *importJob, pool, source, format, target, domain string, registerTemplate bool) error {
+	id := getReqIDFromContext(ctx)
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return err
+	}
+	defer closeConnection(ctx, c)
+
+	path, err := getPoolFilePath(ctx, c, pool, target)
+	if err != nil {
+		return err
+	}
+
+	job.update(func(s *ImportJobStatus) { s.Path = path })
+
+	p, err := lookupPoolByName(ctx, c, pool)
+	if err != nil {
+		return err
+	}
+	defer freePool(ctx, p)
+
+	// target volume is reserved by startImportJob, converted image replaces only this empty volume
+	err = convertDiskImage(ctx, job, source, format, path)
+	if err == nil {
+		err = validateConvertedImage(ctx, source, format, path)
+	}
+
+	if err != nil {
+		removeImportTarget(ctx, c, p, target, path)
+		return err
+	}
+
+	err = refreshPool(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	if registerTemplate {
+		_, err = registerImageTemplate(ctx, c, pool, ImageTemplate{Name: target})
+		if err != nil {
+			return fmt.Errorf("imported, but failed to register template: %s", err.Error())
+		}
+	}
+
+	if len(domain) != 0 {
+		if isLockedAndMakeLock(ctx, domain, 60) {
+			return errors.New("imported, but failed to attach: thread safety lock, function is temporarily unavailable")
+		}
+
+		d, err := lookupDomainByName(ctx, c, domain)
+		if err != nil {
+			return fmt.Errorf("imported, but failed to attach: %s", err.Error())
+		}
+		defer freeDomain(ctx, d)
+
+		dev, err := attachPoolVolumeToDomain(ctx, c, d, pool, target, "scsi", "directsync", nil)
+		if err != nil {
+			return fmt.Errorf("imported, but failed to attach: %s", err.Error())
+		}
+
+		job.update(func(s *ImportJobStatus) { s.AttachedAs = dev })
+	}
+
+	info.Printf("%simported %s as %s/%s\n", id, source, pool, target)
+	return nil
+}
+
+// validates import request, reserves target volume and starts conversion in background, returned job is polled with GetImportJob
+func startImportJob(ctx context.Context, c *libvirt.Connect, pool, sourcePath, format, target, domain string, registerTemplate bool) (ImportJobStatus, error) {
+	id := getReqIDFromContext(ctx)
+
+	err := validateImportDisk(ctx, c, pool, format, target, domain)
+	if err != nil {
+		fail.Printf("%sfailed to validate import: %s\n", id, err.Error())
+		return ImportJobStatus{}, err
+	}
+
+	source, err := resolveImportSource(ctx, c, sourcePath)
+	if err != nil {
+		return ImportJobStatus{}, err
+	}
+
+	// target is reserved before response, so concurrent import or upload with the same name fails instead of overwriting it
+	err = createPoolVolume(ctx, c, pool, target, 0, volumeFormatRaw)
+	if err != nil {
+		return ImportJobStatus{}, err
+	}
+
+	job := &importJob{
+		status: ImportJobStatus{
+			ID:         genUUID(ctx),
+			Pool:       pool,
+			SourcePath: source,
+			Format:     format,
+			TargetName: target,
+			Domain:     domain,
+			State:      importJobRunning,
+			Started:    time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	importJobs.Store(job.status.ID, job)
+
+	// job outlives request, request ID is kept for logs
+	jobCtx := context.WithoutCancel(ctx)
+
+	go func() {
+		job.finish(runImportJob(jobCtx, job, pool, source, format, target, domain, registerTemplate))
+	}()
+
+	info.Printf("%sstarted import job %s for %s\n", id, job.status.ID, source)
+	return job.get(), nil
+}
+
+func getImportJob(ctx context.Context, jobID string) (ImportJobStatus, error) {
+	id := getReqIDFromContext(ctx)
+
+	v, ok := importJobs.Load(jobID)
+	if !ok {
+		fail.Printf("%simport job %s not found\n", id, jobID)
+		return ImportJobStatus{}, fmt.Errorf("import job %s not found", jobID)
+	}
+
+	return v.(*importJob).get(), nil
+}
+
+func listImportJobs() []ImportJobStatus {
+	jobs := make([]ImportJobStatus, 0)
+
+	importJobs.Range(func(k, v interface{}) bool {
+		jobs = append(jobs, v.(*importJob).get())
+		return true
+	})
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started < jobs[j].Started })
+
+	return jobs
+}
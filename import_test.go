@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveImportFile(t *testing.T) {
+	root := t.TempDir()
+
+	dir := filepath.Join(root, "import")
+	outside := filepath.Join(root, "outside.img")
+
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{filepath.Join(dir, "disk.img"), outside} {
+		if err := os.WriteFile(f, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(outside, filepath.Join(dir, "link.img")); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := *importDir
+	defer func() { *importDir = saved }()
+
+	*importDir = dir
+
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{source: filepath.Join(dir, "disk.img")},
+		{source: filepath.Join(dir, "..", "outside.img"), wantErr: true},
+		{source: outside, wantErr: true},
+		{source: filepath.Join(dir, "link.img"), wantErr: true},
+		{source: filepath.Join(dir, "subdir"), wantErr: true},
+		{source: filepath.Join(dir, "missing.img"), wantErr: true},
+		{source: "/etc/shadow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := resolveImportFile(context.Background(), tt.source)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveImportFile(%q) error: %v, expected error: %t", tt.source, err, tt.wantErr)
+		}
+	}
+
+	*importDir = ""
+
+	if _, err := resolveImportFile(context.Background(), filepath.Join(dir, "disk.img")); err == nil {
+		t.Errorf("resolveImportFile() with empty import directory: expected error")
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"strings"
 	"time"
 
 	"github.com/libvirt/libvirt-go"
@@ -107,82 +106,11 @@ func getNodeInfoResponse(ctx context.Context, c *libvirt.Connect) (NodeInfoRespo
 		r.Network = append(r.Network, network)
 	}
 
-	// here we acquire only directory based pools
-	pools, err := listStorgePools(ctx, c, libvirt.CONNECT_LIST_STORAGE_POOLS_DIR)
-	defer freePools(ctx, pools)
+	r.Pool, err = getNodePools(ctx, c)
 	if err != nil {
 		return NodeInfoResponse{}, err
 	}
 
-	for _, pool := range pools {
-		var poolDef nodePool
-
-		poolDef.Name, err = getPoolName(ctx, &pool)
-		if err != nil {
-			continue
-		}
-
-		poolInfo, err := getPoolInfo(ctx, &pool)
-		if err != nil {
-			continue
-		}
-
-		poolDef.Path, err = getPoolPath(ctx, &pool)
-		if err != nil {
-			continue
-		}
-
-		switch poolInfo.State {
-		case libvirt.STORAGE_POOL_INACTIVE:
-			poolDef.State = "STORAGE_POOL_INACTIVE"
-		case libvirt.STORAGE_POOL_BUILDING:
-			poolDef.State = "STORAGE_POOL_BUILDING"
-		case libvirt.STORAGE_POOL_RUNNING:
-			poolDef.State = "STORAGE_POOL_RUNNING"
-		case libvirt.STORAGE_POOL_DEGRADED:
-			poolDef.State = "STORAGE_POOL_DEGRADED"
-		case libvirt.STORAGE_POOL_INACCESSIBLE:
-			poolDef.State = "STORAGE_POOL_INACCESSIBLE"
-		default:
-			poolDef.State = "STORAGE_POOL_UNKNOWN"
-		}
-
-		poolDef.Capacity = poolInfo.Capacity
-		poolDef.Allocation = poolInfo.Allocation
-		poolDef.Available = poolInfo.Available
-
-		poolDef.Autostart, err = isPoolAutostarted(ctx, &pool)
-		if err != nil {
-			poolDef.Autostart = false
-		}
-
-		poolDef.Active, err = isPoolActive(ctx, &pool)
-		if err != nil {
-			poolDef.Active = false
-		}
-
-		poolDef.Persistent, err = isPoolPersistent(ctx, &pool)
-		if err != nil {
-			poolDef.Persistent = false
-		}
-
-		poolDef.VolumesCount, err = countNumOfStorageVolumesInPool(ctx, &pool)
-		if err != nil {
-			poolDef.VolumesCount = 0
-		}
-
-		volumes, err := listPoolVolumes(ctx, &pool)
-		if err == nil {
-			for _, v := range volumes {
-				if strings.Contains(v, "template") {
-					poolDef.Templates = append(poolDef.Templates, v)
-				}
-			}
-		}
-
-		r.Pool = append(r.Pool, poolDef)
-	}
-
 	return r, nil
 }
 
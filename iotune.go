@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+)
+
+/* global variable declaration, if any... */
+const defaultBlockIOProfile = "bronze"
+
+var blockIOProfiles = defaultBlockIOProfiles()
+
+// default profile limits disks of default template, disks attached without IO tune values and SetBlockIoTune bursts, profiles file can change but not remove it
+func defaultBlockIOProfiles() map[string]blockIO {
+	return map[string]blockIO{
+		"bronze": {
+			ReadIopsSec:           1000,
+			WriteIopsSec:          400,
+			ReadIopsSecMax:        1100,
+			WriteIopsSecMax:       450,
+			ReadIopsSecMaxLength:  15,
+			WriteIopsSecMaxLength: 5,
+		},
+		"silver": {
+			ReadIopsSec:           3000,
+			WriteIopsSec:          1500,
+			ReadIopsSecMax:        4000,
+			WriteIopsSecMax:       2000,
+			ReadIopsSecMaxLength:  30,
+			WriteIopsSecMaxLength: 15,
+			TotalBytesSec:         200 * 1024 * 1024,
+			TotalBytesSecMax:      300 * 1024 * 1024,
+		},
+		"gold": {
+			ReadIopsSec:           10000,
+			WriteIopsSec:          5000,
+			ReadIopsSecMax:        15000,
+			WriteIopsSecMax:       7500,
+			ReadIopsSecMaxLength:  60,
+			WriteIopsSecMaxLength: 30,
+			TotalBytesSec:         500 * 1024 * 1024,
+			TotalBytesSecMax:      800 * 1024 * 1024,
+		},
+	}
+}
+
+// loadBlockIOProfiles reads JSON file with named profiles, profile in file replaces default profile of same name, missing file means defaults
+func loadBlockIOProfiles(path string) (map[string]blockIO, error) {
+	p := defaultBlockIOProfiles()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return p, fmt.Errorf("failed to parse block IO profiles %s: %s", path, err.Error())
+	}
+
+	for name, params := range p {
+		err = validateBlockIOTune(params)
+		if err != nil {
+			return p, fmt.Errorf("block IO profile %s: %s", name, err.Error())
+		}
+	}
+
+	return p, nil
+}
+
+func getBlockIOProfile(ctx context.Context, name string) (blockIO, error) {
+	id := getReqIDFromContext(ctx)
+
+	params, ok := blockIOProfiles[name]
+	if !ok {
+		names := make([]string, 0, len(blockIOProfiles))
+		for k := range blockIOProfiles {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		fail.Printf("%sunknown block IO profile: %s\n", id, name)
+		return blockIO{}, fmt.Errorf("unknown block IO profile: %s, available: %s", name, strings.Join(names, ", "))
+	}
+
+	return params, nil
+}
+
+// checks combinations rejected by libvirt: total limit with read/write limit, burst without limit or lower than limit, burst length without burst
+func validateBlockIOTune(params blockIO) error {
+	problems := make([]string, 0)
+
+	if params.TotalBytesSec != 0 && (params.ReadBytesSec != 0 || params.WriteBytesSec != 0) {
+		problems = append(problems, "total bytes/s limit can not be combined with read or write bytes/s limit")
+	}
+
+	if params.TotalIopsSec != 0 && (params.ReadIopsSec != 0 || params.WriteIopsSec != 0) {
+		problems = append(problems, "total iops limit can not be combined with read or write iops limit")
+	}
+
+	if params.TotalBytesSecMax != 0 && (params.ReadBytesSecMax != 0 || params.WriteBytesSecMax != 0) {
+		problems = append(problems, "total bytes/s burst can not be combined with read or write bytes/s burst")
+	}
+
+	if params.TotalIopsSecMax != 0 && (params.ReadIopsSecMax != 0 || params.WriteIopsSecMax != 0) {
+		problems = append(problems, "total iops burst can not be combined with read or write iops burst")
+	}
+
+	bursts := []struct {
+		name                 string
+		limit, burst, length uint64
+	}{
+		{"total bytes/s", params.TotalBytesSec, params.TotalBytesSecMax, params.TotalBytesSecMaxLength},
+		{"read bytes/s", params.ReadBytesSec, params.ReadBytesSecMax, params.ReadBytesSecMaxLength},
+		{"write bytes/s", params.WriteBytesSec, params.WriteBytesSecMax, params.WriteBytesSecMaxLength},
+		{"total iops", params.TotalIopsSec, params.TotalIopsSecMax, params.TotalIopsSecMaxLength},
+		{"read iops", params.ReadIopsSec, params.ReadIopsSecMax, params.ReadIopsSecMaxLength},
+		{"write iops", params.WriteIopsSec, params.WriteIopsSecMax, params.WriteIopsSecMaxLength},
+	}
+
+	for _, b := range bursts {
+		if b.burst != 0 && b.limit == 0 {
+			problems = append(problems, fmt.Sprintf("%s burst requires limit", b.name))
+		} else if b.burst != 0 && b.burst < b.limit {
+			problems = append(problems, fmt.Sprintf("%s burst %d is lower than limit %d", b.name, b.burst, b.limit))
+		}
+
+		if b.length != 0 && b.burst == 0 {
+			problems = append(problems, fmt.Sprintf("%s burst length requires burst", b.name))
+		}
+	}
+
+	if params.SizeIopsSec != 0 && params.TotalIopsSec == 0 && params.ReadIopsSec == 0 && params.WriteIopsSec == 0 {
+		problems = append(problems, "size of IO operation requires iops limit")
+	}
+
+	switch params.ModificationImpact {
+	case "", domainAffectCurrent, domainAffectLive, domainAffectConfig:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown modification impact: %s, supported: %s, %s, %s", params.ModificationImpact, domainAffectCurrent, domainAffectLive, domainAffectConfig))
+	}
+
+	if len(problems) != 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// modification impact of block IO tune, empty value means live (for active domain) and persistent config
+func getBlockIOTuneImpact(ctx context.Context, d *libvirt.Domain, impact string) libvirt.DomainModificationImpact {
+	switch impact {
+	case domainAffectCurrent:
+		return libvirt.DOMAIN_AFFECT_CURRENT
+	case domainAffectLive:
+		return libvirt.DOMAIN_AFFECT_LIVE
+	case domainAffectConfig:
+		return libvirt.DOMAIN_AFFECT_CONFIG
+	}
+
+	return getDomainModificationImpact(ctx, d)
+}
+
+// sets every iotune field of block device, zero value removes limit, empty group name keeps current group
+func setDomainBlockIOTuneParams(ctx context.Context, d *libvirt.Domain, dev string, params blockIO) error {
+	id := getReqIDFromContext(ctx)
+
+	err := validateBlockIOTune(params)
+	if err != nil {
+		fail.Printf("%sfailed to validate block IO tune values: %s\n", id, err.Error())
+		return err
+	}
+
+	s := libvirt.DomainBlockIoTuneParameters{
+		TotalBytesSecSet:          true,
+		TotalBytesSec:             params.TotalBytesSec,
+		ReadBytesSecSet:           true,
+		ReadBytesSec:              params.ReadBytesSec,
+		WriteBytesSecSet:          true,
+		WriteBytesSec:             params.WriteBytesSec,
+		TotalIopsSecSet:           true,
+		TotalIopsSec:              params.TotalIopsSec,
+		ReadIopsSecSet:            true,
+		ReadIopsSec:               params.ReadIopsSec,
+		WriteIopsSecSet:           true,
+		WriteIopsSec:              params.WriteIopsSec,
+		TotalBytesSecMaxSet:       true,
+		TotalBytesSecMax:          params.TotalBytesSecMax,
+		ReadBytesSecMaxSet:        true,
+		ReadBytesSecMax:           params.ReadBytesSecMax,
+		WriteBytesSecMaxSet:       true,
+		WriteBytesSecMax:          params.WriteBytesSecMax,
+		TotalIopsSecMaxSet:        true,
+		TotalIopsSecMax:           params.TotalIopsSecMax,
+		ReadIopsSecMaxSet:         true,
+		ReadIopsSecMax:            params.ReadIopsSecMax,
+		WriteIopsSecMaxSet:        true,
+		WriteIopsSecMax:           params.WriteIopsSecMax,
+		TotalBytesSecMaxLengthSet: true,
+		TotalBytesSecMaxLength:    params.TotalBytesSecMaxLength,
+		ReadBytesSecMaxLengthSet:  true,
+		ReadBytesSecMaxLength:     params.ReadBytesSecMaxLength,
+		WriteBytesSecMaxLengthSet: true,
+		WriteBytesSecMaxLength:    params.WriteBytesSecMaxLength,
+		TotalIopsSecMaxLengthSet:  true,
+		TotalIopsSecMaxLength:     params.TotalIopsSecMaxLength,
+		ReadIopsSecMaxLengthSet:   true,
+		ReadIopsSecMaxLength:      params.ReadIopsSecMaxLength,
+		WriteIopsSecMaxLengthSet:  true,
+		WriteIopsSecMaxLength:     params.WriteIopsSecMaxLength,
+		SizeIopsSecSet:            true,
+		SizeIopsSec:               params.SizeIopsSec,
+		GroupNameSet:              len(params.GroupName) != 0,
+		GroupName:                 params.GroupName,
+	}
+
+	flags := getBlockIOTuneImpact(ctx, d, params.ModificationImpact)
+
+	err = d.SetBlockIoTune(dev, &s, flags)
+	if err != nil {
+		fail.Printf("%sfailed to set block device %s IO policy for domain: %s\n", id, dev, err.Error())
+		return err
+	}
+
+	info.Printf("%sset block IO tune values for: %s, with flag: %d\n", id, dev, flags)
+	return nil
+}
+
+func setDomainBlockIOProfile(ctx context.Context, d *libvirt.Domain, dev, profile string) error {
+	id := getReqIDFromContext(ctx)
+
+	params, err := getBlockIOProfile(ctx, profile)
+	if err != nil {
+		return err
+	}
+
+	params.ModificationImpact = ""
+
+	err = setDomainBlockIOTuneParams(ctx, d, dev, params)
+	if err != nil {
+		return err
+	}
+
+	info.Printf("%sapplied block IO profile %s to %s\n", id, profile, dev)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestValidateBlockIOTune(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  blockIO
+		wantErr bool
+	}{
+		{name: "empty", params: blockIO{}},
+		{name: "read and write iops with bursts", params: blockIO{ReadIopsSec: 1000, ReadIopsSecMax: 1100, ReadIopsSecMaxLength: 15, WriteIopsSec: 400}},
+		{name: "total bytes with burst", params: blockIO{TotalBytesSec: 1000, TotalBytesSecMax: 2000}},
+		{name: "size with iops limit", params: blockIO{TotalIopsSec: 1000, SizeIopsSec: 4096}},
+		{name: "known impact", params: blockIO{ModificationImpact: domainAffectLive}},
+		{name: "total and read bytes", params: blockIO{TotalBytesSec: 1000, ReadBytesSec: 1000}, wantErr: true},
+		{name: "total and write iops", params: blockIO{TotalIopsSec: 1000, WriteIopsSec: 1000}, wantErr: true},
+		{name: "total and read bytes bursts", params: blockIO{TotalBytesSec: 1000, TotalBytesSecMax: 2000, ReadBytesSecMax: 2000}, wantErr: true},
+		{name: "total and read iops bursts", params: blockIO{TotalIopsSec: 1000, TotalIopsSecMax: 2000, ReadIopsSecMax: 2000}, wantErr: true},
+		{name: "burst lower than limit", params: blockIO{ReadIopsSec: 1000, ReadIopsSecMax: 900}, wantErr: true},
+		{name: "burst without limit", params: blockIO{WriteBytesSecMax: 2000}, wantErr: true},
+		{name: "burst length without burst", params: blockIO{ReadIopsSec: 1000, ReadIopsSecMaxLength: 15}, wantErr: true},
+		{name: "size without iops limit", params: blockIO{TotalBytesSec: 1000, SizeIopsSec: 4096}, wantErr: true},
+		{name: "unknown impact", params: blockIO{ModificationImpact: "DOMAIN_AFFECT_ALL"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := validateBlockIOTune(tt.params)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateBlockIOTune() error: %v, expected error: %t", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDefaultBlockIOProfilesAreValid(t *testing.T) {
+	profiles := defaultBlockIOProfiles()
+
+	if _, ok := profiles[defaultBlockIOProfile]; !ok {
+		t.Fatalf("default block IO profile %s is not defined", defaultBlockIOProfile)
+	}
+
+	for name, params := range profiles {
+		if err := validateBlockIOTune(params); err != nil {
+			t.Errorf("block IO profile %s: %v", name, err)
+		}
+	}
+}
+
+func TestDefaultTemplateDiskIOTune(t *testing.T) {
+	vars := DomainTemplateVars{
+		UUID:      "00000000-0000-0000-0000-000000000001",
+		Name:      "vm-001",
+		VCPU:      1,
+		MaxVCPU:   1,
+		Memory:    1048576,
+		MaxMemory: 1048576,
+		Disks:     []DomainTemplateDisk{{Path: "/var/lib/libvirt/images/vm-001.qcow2", Target: "sda", Bus: "scsi"}},
+	}
+
+	domCfg, err := renderDomainTemplate(context.Background(), defaultDomainTemplate, vars)
+	if err != nil {
+		t.Fatalf("renderDomainTemplate() error: %v", err)
+	}
+
+	if domCfg.Devices == nil || len(domCfg.Devices.Disks) == 0 || domCfg.Devices.Disks[0].IOTune == nil {
+		t.Fatalf("rendered disk has no iotune")
+	}
+
+	got, want := *domCfg.Devices.Disks[0].IOTune, *getDomainDiskIOTune(nil)
+	if got != want {
+		t.Errorf("rendered disk iotune %+v, want default profile %+v", got, want)
+	}
+}
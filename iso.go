@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+/*
+	Minimal ISO9660 image writer: single root directory with plain files,
+	primary volume descriptor with 8.3 names and Joliet supplementary
+	volume descriptor with original (long, lower case) names.
+
+	Layout (2048 byte sectors):
+	  0-15  system area
+	  16    primary volume descriptor
+	  17    supplementary (Joliet) volume descriptor
+	  18    volume descriptor set terminator
+	  19-22 path tables (L/M primary, L/M Joliet)
+	  23    primary root directory
+	  24    Joliet root directory
+	  25-   file data
+*/
+
+const (
+	isoSectorSize     = 2048
+	isoPVDSector      = 16
+	isoSVDSector      = 17
+	isoTermSector     = 18
+	isoPathTableStart = 19
+	isoRootSector     = 23
+	isoJolietRoot     = 24
+	isoDataStart      = 25
+)
+
+type isoFile struct {
+	name string // names must be sorted and unique
+	data []byte
+}
+
+func isoSectors(size int) int {
+	return (size + isoSectorSize - 1) / isoSectorSize
+}
+
+func isoBothEndian32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b[0:4], v)
+	binary.BigEndian.PutUint32(b[4:8], v)
+}
+
+func isoBothEndian16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b[0:2], v)
+	binary.BigEndian.PutUint16(b[2:4], v)
+}
+
+func isoPadString(b []byte, s string) {
+	for i := range b {
+		b[i] = ' '
+	}
+	copy(b, s)
+}
+
+func isoUCS2(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, r := range u {
+		binary.BigEndian.PutUint16(b[2*i:], r)
+	}
+
+	return b
+}
+
+func isoPadUCS2(b []byte, s string) {
+	for i := 0; i+1 < len(b); i += 2 {
+		b[i] = 0x00
+		b[i+1] = ' '
+	}
+	copy(b, isoUCS2(s))
+}
+
+// d-characters only, 8.3 form with version suffix
+func isoShortName(name string, index int) string {
+	base := strings.ToUpper(name)
+	base = strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, base)
+
+	if len(base) > 6 {
+		base = base[:6]
+	}
+
+	return fmt.Sprintf("%s%02d.;1", base, index)
+}
+
+func isoDecDateTime(t time.Time) []byte {
+	return append([]byte(t.UTC().Format("20060102150405")+"00"), 0)
+}
+
+func isoDirRecord(extent, size uint32, isDir bool, name []byte, t time.Time) []byte {
+	recLen := 33 + len(name)
+	if recLen%2 != 0 {
+		recLen++
+	}
+
+	r := make([]byte, recLen)
+	r[0] = byte(recLen)
+	isoBothEndian32(r[2:10], extent)
+	isoBothEndian32(r[10:18], size)
+
+	t = t.UTC()
+	r[18] = byte(t.Year() - 1900)
+	r[19] = byte(t.Month())
+	r[20] = byte(t.Day())
+	r[21] = byte(t.Hour())
+	r[22] = byte(t.Minute())
+	r[23] = byte(t.Second())
+
+	if isDir {
+		r[25] = 0x02
+	}
+
+	isoBothEndian16(r[28:32], 1)
+	r[32] = byte(len(name))
+	copy(r[33:], name)
+
+	return r
+}
+
+func isoPathTable(rootSector uint32, bigEndian bool) []byte {
+	t := make([]byte, 10)
+	t[0] = 1
+
+	if bigEndian {
+		binary.BigEndian.PutUint32(t[2:6], rootSector)
+		binary.BigEndian.PutUint16(t[6:8], 1)
+	} else {
+		binary.LittleEndian.PutUint32(t[2:6], rootSector)
+		binary.LittleEndian.PutUint16(t[6:8], 1)
+	}
+
+	return t
+}
+
+func isoVolumeDescriptor(joliet bool, volumeID string, totalSectors uint32, t time.Time) []byte {
+	vd := make([]byte, isoSectorSize)
+
+	rootSector := uint32(isoRootSector)
+	pathTable := uint32(isoPathTableStart)
+
+	vd[0] = 1
+	if joliet {
+		vd[0] = 2
+		rootSector = isoJolietRoot
+		pathTable = isoPathTableStart + 2
+	}
+
+	copy(vd[1:6], "CD001")
+	vd[6] = 1
+
+	if joliet {
+		isoPadUCS2(vd[8:40], "")
+		isoPadUCS2(vd[40:72], volumeID)
+		copy(vd[88:91], "%/E") // UCS-2 level 3
+	} else {
+		isoPadString(vd[8:40], "")
+		isoPadString(vd[40:72], volumeID)
+	}
+
+	isoBothEndian32(vd[80:88], totalSectors)
+	isoBothEndian16(vd[120:124], 1)
+	isoBothEndian16(vd[124:128], 1)
+	isoBothEndian16(vd[128:132], isoSectorSize)
+	isoBothEndian32(vd[132:140], 10)
+	binary.LittleEndian.PutUint32(vd[140:144], pathTable)
+	binary.BigEndian.PutUint32(vd[148:152], pathTable+1)
+
+	copy(vd[156:190], isoDirRecord(rootSector, isoSectorSize, true, []byte{0x00}, t))
+
+	for _, f := range [][]byte{vd[190:318], vd[318:446], vd[446:574], vd[574:702], vd[702:739], vd[739:776], vd[776:813]} {
+		if joliet {
+			isoPadUCS2(f, "")
+		} else {
+			isoPadString(f, "")
+		}
+	}
+
+	now := isoDecDateTime(t)
+	copy(vd[813:830], now)
+	copy(vd[830:847], now)
+	copy(vd[847:864], "0000000000000000")
+	copy(vd[864:881], now)
+	vd[881] = 1
+
+	return vd
+}
+
+func isoRootDirectory(joliet bool, files []isoFile, t time.Time) ([]byte, error) {
+	rootSector := uint32(isoRootSector)
+	if joliet {
+		rootSector = isoJolietRoot
+	}
+
+	dir := make([]byte, 0, isoSectorSize)
+	dir = append(dir, isoDirRecord(rootSector, isoSectorSize, true, []byte{0x00}, t)...)
+	dir = append(dir, isoDirRecord(rootSector, isoSectorSize, true, []byte{0x01}, t)...)
+
+	extent := uint32(isoDataStart)
+	for i, f := range files {
+		name := []byte(isoShortName(f.name, i))
+		if joliet {
+			name = isoUCS2(f.name)
+		}
+
+		dir = append(dir, isoDirRecord(extent, uint32(len(f.data)), false, name, t)...)
+		extent += uint32(isoSectors(len(f.data)))
+	}
+
+	if len(dir) > isoSectorSize {
+		return nil, fmt.Errorf("too many files for single sector ISO9660 root directory")
+	}
+
+	return append(dir, make([]byte, isoSectorSize-len(dir))...), nil
+}
+
+// buildISO9660 returns ISO9660 image with Joliet extension containing files in root directory
+func buildISO9660(volumeID string, files []isoFile) ([]byte, error) {
+	t := time.Now()
+
+	totalSectors := isoDataStart
+	for _, f := range files {
+		if len(f.name) == 0 || len(f.name) > 64 || strings.ContainsAny(f.name, "/;*:\\") {
+			return nil, fmt.Errorf("not valid ISO9660 file name: %s", f.name)
+		}
+		totalSectors += isoSectors(len(f.data))
+	}
+
+	var b bytes.Buffer
+	b.Grow(totalSectors * isoSectorSize)
+
+	b.Write(make([]byte, isoPVDSector*isoSectorSize))
+	b.Write(isoVolumeDescriptor(false, volumeID, uint32(totalSectors), t))
+	b.Write(isoVolumeDescriptor(true, volumeID, uint32(totalSectors), t))
+
+	term := make([]byte, isoSectorSize)
+	term[0] = 255
+	copy(term[1:6], "CD001")
+	term[6] = 1
+	b.Write(term)
+
+	for _, root := range []uint32{isoRootSector, isoJolietRoot} {
+		for _, bigEndian := range []bool{false, true} {
+			pt := isoPathTable(root, bigEndian)
+			b.Write(append(pt, make([]byte, isoSectorSize-len(pt))...))
+		}
+	}
+
+	for _, joliet := range []bool{false, true} {
+		dir, err := isoRootDirectory(joliet, files, t)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(dir)
+	}
+
+	for _, f := range files {
+		b.Write(f.data)
+		if pad := isoSectors(len(f.data))*isoSectorSize - len(f.data); pad > 0 {
+			b.Write(make([]byte, pad))
+		}
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+type isoTestRecord struct {
+	name   string
+	extent uint32
+	size   uint32
+	isDir  bool
+}
+
+func isoTestSector(t *testing.T, img []byte, sector uint32) []byte {
+	t.Helper()
+
+	start := int(sector) * isoSectorSize
+	if start+isoSectorSize > len(img) {
+		t.Fatalf("sector %d is out of image of %d bytes", sector, len(img))
+	}
+
+	return img[start : start+isoSectorSize]
+}
+
+func isoTestUCS2(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, binary.BigEndian.Uint16(b[i:]))
+	}
+
+	return string(utf16.Decode(u))
+}
+
+// reads directory records of single sector directory, both-endian fields must match
+func isoTestReadDir(t *testing.T, dir []byte, joliet bool) []isoTestRecord {
+	t.Helper()
+
+	records := make([]isoTestRecord, 0)
+
+	for off := 0; off < len(dir) && dir[off] != 0; off += int(dir[off]) {
+		r := dir[off : off+int(dir[off])]
+
+		extent := binary.LittleEndian.Uint32(r[2:6])
+		if extent != binary.BigEndian.Uint32(r[6:10]) {
+			t.Fatalf("record at %d: extent little endian %d, big endian %d", off, extent, binary.BigEndian.Uint32(r[6:10]))
+		}
+
+		size := binary.LittleEndian.Uint32(r[10:14])
+		if size != binary.BigEndian.Uint32(r[14:18]) {
+			t.Fatalf("record at %d: size little endian %d, big endian %d", off, size, binary.BigEndian.Uint32(r[14:18]))
+		}
+
+		name := r[33 : 33+int(r[32])]
+
+		rec := isoTestRecord{extent: extent, size: size, isDir: r[25]&0x02 != 0}
+		if joliet && len(name) > 1 {
+			rec.name = isoTestUCS2(name)
+		} else {
+			rec.name = string(name)
+		}
+
+		records = append(records, rec)
+	}
+
+	return records
+}
+
+func TestBuildISO9660(t *testing.T) {
+	tests := []struct {
+		name       string
+		volumeID   string
+		files      []isoFile
+		shortNames []string
+	}{
+		{
+			name:       "cloud-init seed",
+			volumeID:   cloudInitVolumeID,
+			files:      []isoFile{{name: "meta-data", data: []byte("instance-id: 1\n")}, {name: "user-data", data: []byte("#cloud-config\n")}},
+			shortNames: []string{"META_D00.;1", "USER_D01.;1"},
+		},
+		{
+			name:     "multi sector and empty files",
+			volumeID: "data",
+			files: []isoFile{
+				{name: "big", data: bytes.Repeat([]byte("0123456789abcdef"), 300)},
+				{name: "empty", data: []byte{}},
+				{name: "network-config", data: []byte("version: 2\n")},
+			},
+			shortNames: []string{"BIG00.;1", "EMPTY01.;1", "NETWOR02.;1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := buildISO9660(tt.volumeID, tt.files)
+			if err != nil {
+				t.Fatalf("buildISO9660() error: %v", err)
+			}
+
+			if len(img)%isoSectorSize != 0 {
+				t.Fatalf("image size %d is not multiple of sector size", len(img))
+			}
+
+			pvd := isoTestSector(t, img, isoPVDSector)
+			svd := isoTestSector(t, img, isoSVDSector)
+			term := isoTestSector(t, img, isoTermSector)
+
+			if pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+				t.Fatalf("primary volume descriptor: type %d, id %q", pvd[0], pvd[1:6])
+			}
+
+			if svd[0] != 2 || string(svd[1:6]) != "CD001" || string(svd[88:91]) != "%/E" {
+				t.Fatalf("Joliet volume descriptor: type %d, id %q, escape %q", svd[0], svd[1:6], svd[88:91])
+			}
+
+			if term[0] != 255 || string(term[1:6]) != "CD001" {
+				t.Fatalf("volume descriptor set terminator: type %d, id %q", term[0], term[1:6])
+			}
+
+			if got := strings.TrimRight(string(pvd[40:72]), " "); got != tt.volumeID {
+				t.Errorf("primary volume ID %q, want %q", got, tt.volumeID)
+			}
+
+			if got := strings.TrimRight(isoTestUCS2(svd[40:72]), " "); got != tt.volumeID {
+				t.Errorf("Joliet volume ID %q, want %q", got, tt.volumeID)
+			}
+
+			for _, vd := range [][]byte{pvd, svd} {
+				if total := binary.LittleEndian.Uint32(vd[80:84]); int(total)*isoSectorSize != len(img) {
+					t.Errorf("volume space size %d sectors, image has %d", total, len(img)/isoSectorSize)
+				}
+			}
+
+			for _, c := range []struct {
+				vd     []byte
+				root   uint32
+				joliet bool
+				names  []string
+			}{
+				{pvd, isoRootSector, false, tt.shortNames},
+				{svd, isoJolietRoot, true, nil},
+			} {
+				if root := binary.LittleEndian.Uint32(c.vd[158:162]); root != c.root {
+					t.Fatalf("root directory record points to sector %d, want %d", root, c.root)
+				}
+
+				records := isoTestReadDir(t, isoTestSector(t, img, c.root), c.joliet)
+				if len(records) != len(tt.files)+2 {
+					t.Fatalf("root directory has %d records, want %d", len(records), len(tt.files)+2)
+				}
+
+				if !records[0].isDir || records[0].name != "\x00" || !records[1].isDir || records[1].name != "\x01" {
+					t.Errorf("root directory does not start with . and .. records: %+v", records[:2])
+				}
+
+				for i, f := range tt.files {
+					rec := records[i+2]
+
+					want := f.name
+					if !c.joliet {
+						want = c.names[i]
+					}
+
+					if rec.name != want {
+						t.Errorf("record %d name %q, want %q", i, rec.name, want)
+					}
+
+					if rec.isDir || int(rec.size) != len(f.data) {
+						t.Errorf("record %d: directory %t, size %d, want file of %d bytes", i, rec.isDir, rec.size, len(f.data))
+					}
+
+					start := int(rec.extent) * isoSectorSize
+					if start+len(f.data) > len(img) || !bytes.Equal(img[start:start+len(f.data)], f.data) {
+						t.Errorf("content of %s at sector %d does not match", f.name, rec.extent)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBuildISO9660InvalidName(t *testing.T) {
+	for _, name := range []string{"", "dir/file", "file;1", strings.Repeat("a", 65)} {
+		_, err := buildISO9660("data", []isoFile{{name: name, data: []byte("x")}})
+		if err == nil {
+			t.Errorf("buildISO9660() with file name %q: expected error", name)
+		}
+	}
+}
+
+func TestBuildCloudInitSeed(t *testing.T) {
+	img, err := buildCloudInitSeed(context.Background(), "uuid-1", "vm-001", "#cloud-config\n", "")
+	if err != nil {
+		t.Fatalf("buildCloudInitSeed() error: %v", err)
+	}
+
+	records := isoTestReadDir(t, isoTestSector(t, img, isoJolietRoot), true)
+
+	names := make([]string, 0, len(records))
+	for _, r := range records[2:] {
+		names = append(names, r.name)
+	}
+
+	if got := strings.Join(names, ","); got != "meta-data,user-data" {
+		t.Errorf("seed files %s, want meta-data,user-data", got)
+	}
+
+	meta := records[2]
+	data := string(img[int(meta.extent)*isoSectorSize : int(meta.extent)*isoSectorSize+int(meta.size)])
+	if data != "instance-id: uuid-1\nlocal-hostname: vm-001\n" {
+		t.Errorf("meta-data content %q", data)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
 	"github.com/semrush/zenrpc"
 )
 
@@ -132,6 +134,163 @@ func (as JRPCService) Info(ctx context.Context, Domain string) (InfoResponse, er
 	return r[0], nil
 }
 
+// BulkInfo - acquires metric(s) and info from all domains matching label selector, empty selector matches all domains
+func (as JRPCService) BulkInfo(ctx context.Context, Selector string) ([]InfoResponse, error) {
+	isLocked := isLockedAndMakeLock(ctx, "Local Hypervisor", 10)
+	if isLocked {
+		return []InfoResponse{}, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "ro")
+	if err != nil {
+		return []InfoResponse{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	domObjs, err := listDomainsBySelector(ctx, c, Selector)
+	if err != nil {
+		return []InfoResponse{}, err
+	}
+	defer freeDomains(ctx, domObjs)
+
+	if len(domObjs) == 0 {
+		return []InfoResponse{}, nil
+	}
+
+	flags := libvirt.DOMAIN_STATS_BALLOON |
+		libvirt.DOMAIN_STATS_BLOCK |
+		libvirt.DOMAIN_STATS_CPU_TOTAL |
+		libvirt.DOMAIN_STATS_STATE |
+		libvirt.DOMAIN_STATS_VCPU
+
+	doms := make([]*libvirt.Domain, 0, len(domObjs))
+	for i := range domObjs {
+		doms = append(doms, &domObjs[i])
+	}
+
+	s, err := getDomainsStats(ctx, c, doms, flags)
+	if err != nil {
+		return []InfoResponse{}, err
+	}
+
+	return getDomainsInfoResponse(ctx, s, len(s)), nil
+}
+
+// BulkAction - runs action (start, shutdown, reboot, suspend, snapshot) on all domains matching label selector with bounded parallelism, start honours priority label (higher first)
+func (as JRPCService) BulkAction(ctx context.Context, Action, Selector string, Parallelism int, StopOnError bool) ([]BulkActionResult, error) {
+	if !isStringInSlice(Action, bulkActions) {
+		return []BulkActionResult{}, fmt.Errorf("unknown bulk action: %s, supported: %s", Action, strings.Join(bulkActions, ", "))
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return []BulkActionResult{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	domObjs, err := listDomainsBySelector(ctx, c, Selector)
+	if err != nil {
+		return []BulkActionResult{}, err
+	}
+	defer freeDomains(ctx, domObjs)
+
+	return runBulkAction(ctx, domObjs, Action, Parallelism, StopOnError), nil
+}
+
+// GetLabels - acquires labels of domain
+func (as JRPCService) GetLabels(ctx context.Context, Domain string) (map[string]string, error) {
+	c, err := openConnection(ctx, "ro")
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return nil, err
+	}
+	defer freeDomain(ctx, d)
+
+	return getDomainLabels(ctx, d)
+}
+
+// SetLabels - adds labels to domain, existing labels with same keys are overwritten
+func (as JRPCService) SetLabels(ctx context.Context, Domain string, Labels map[string]string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	err := validateLabels(Labels)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	labels, err := getDomainLabels(ctx, d)
+	if err != nil {
+		return false, err
+	}
+
+	for k, v := range Labels {
+		labels[k] = v
+	}
+
+	err = setDomainLabels(ctx, d, labels)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RemoveLabels - removes labels with supplied keys from domain, missing keys are ignored
+func (as JRPCService) RemoveLabels(ctx context.Context, Domain string, Keys []string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	labels, err := getDomainLabels(ctx, d)
+	if err != nil {
+		return false, err
+	}
+
+	for _, k := range Keys {
+		delete(labels, k)
+	}
+
+	err = setDomainLabels(ctx, d, labels)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 // QemuAgentInfo - refreshes usage statistics for all directory based storage pools
 func (as JRPCService) QemuAgentInfo(ctx context.Context, Domain string) (QemuAgentResponse, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
@@ -169,8 +328,8 @@ func (as JRPCService) QemuAgentInfo(ctx context.Context, Domain string) (QemuAge
 	return r, nil
 }
 
-// Domains - acquires list of domains
-func (as JRPCService) Domains(ctx context.Context, Search string) ([]string, error) {
+// Domains - acquires list of domains, Search is case-insensitive name prefix, Selector is label selector (env=prod,team!=qa)
+func (as JRPCService) Domains(ctx context.Context, Search, Selector string) ([]string, error) {
 	isLocked := isLockedAndMakeLock(ctx, "Local Hypervisor", 10)
 	if isLocked {
 		return []string{}, errors.New("thread safety lock, function is temporarily unavailable")
@@ -182,7 +341,7 @@ func (as JRPCService) Domains(ctx context.Context, Search string) ([]string, err
 	}
 	defer closeConnection(ctx, c)
 
-	domObjs, err := listAllDomainsWithFlags(ctx, c, libvirt.ConnectListAllDomainsFlags(0))
+	domObjs, err := listDomainsBySelector(ctx, c, Selector)
 	if err != nil {
 		return []string{}, err
 	}
@@ -317,7 +476,7 @@ func (as JRPCService) SetPassword(ctx context.Context, Domain string, VMUser str
 	return true, nil
 }
 
-// SetMemory - sets current available memory [KiB] for domain
+// SetMemory - sets current available memory [KiB] for domain, maximum memory of domain stays admitted by policy
 func (as JRPCService) SetMemory(ctx context.Context, Domain string, Memory uint64) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
@@ -344,6 +503,11 @@ func (as JRPCService) SetMemory(ctx context.Context, Domain string, Memory uint6
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
+	ok, err = validateDomainMemory(ctx, c, d, Memory, false)
+	if err != nil || !ok {
+		return false, err
+	}
+
 	err = setDomainCurrentMemory(ctx, d, Memory)
 	if err != nil {
 		return false, err
@@ -387,7 +551,7 @@ func (as JRPCService) SetMemoryStatsPeriod(ctx context.Context, Domain string, P
 	return true, nil
 }
 
-// SetMaxMemory - sets maximum available memory [KiB] for domain
+// SetMaxMemory - sets maximum available memory [KiB] for domain, increase is checked against per domain limit and memory overcommit of admission policy
 func (as JRPCService) SetMaxMemory(ctx context.Context, Domain string, Memory uint64) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
@@ -419,6 +583,16 @@ func (as JRPCService) SetMaxMemory(ctx context.Context, Domain string, Memory ui
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
+	ok, err = validateDomainMemory(ctx, c, d, Memory, true)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = checkDomainTenantQuota(ctx, c, d, 0, Memory)
+	if err != nil {
+		return false, err
+	}
+
 	err = setDomainMaxMemory(ctx, d, Memory)
 	if err != nil {
 		return false, err
@@ -427,7 +601,7 @@ func (as JRPCService) SetMaxMemory(ctx context.Context, Domain string, Memory ui
 	return true, nil
 }
 
-// SetVCPUs - sets current available vCPUs for domain
+// SetVCPUs - sets current available vCPUs for domain, increase is checked against per domain limit and CPU overcommit of admission policy
 func (as JRPCService) SetVCPUs(ctx context.Context, Domain string, VCPUsNum uint) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
@@ -454,6 +628,16 @@ func (as JRPCService) SetVCPUs(ctx context.Context, Domain string, VCPUsNum uint
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
+	ok, err = validateDomainVCPUs(ctx, c, d, VCPUsNum, false)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = checkDomainTenantQuota(ctx, c, d, VCPUsNum, 0)
+	if err != nil {
+		return false, err
+	}
+
 	err = setDomainCurrentVCPUs(ctx, d, VCPUsNum)
 	if err != nil {
 		return false, err
@@ -462,7 +646,7 @@ func (as JRPCService) SetVCPUs(ctx context.Context, Domain string, VCPUsNum uint
 	return true, nil
 }
 
-// SetMaxVCPUs - sets maximum available vCPUs for domain
+// SetMaxVCPUs - sets maximum available vCPUs for domain, limited by per domain limit of admission policy
 func (as JRPCService) SetMaxVCPUs(ctx context.Context, Domain string, VCPUsNum uint) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
@@ -494,6 +678,11 @@ func (as JRPCService) SetMaxVCPUs(ctx context.Context, Domain string, VCPUsNum u
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
+	ok, err = validateDomainVCPUs(ctx, c, d, VCPUsNum, true)
+	if err != nil || !ok {
+		return false, err
+	}
+
 	err = setDomainMaxVCPUs(ctx, d, VCPUsNum)
 	if err != nil {
 		return false, err
@@ -572,8 +761,8 @@ func (as JRPCService) SetDomainDeviceIOPS(ctx context.Context, Domain string, De
 	return true, nil
 }
 
-// SetAutostart - sets autostart action for domain
-func (as JRPCService) SetAutostart(ctx context.Context, Domain string, Autostart bool) (bool, error) {
+// SetBlockIOTune - sets all block device IO tune values for domain, zero value removes limit, Params.ModificationImpact selects scope (empty is live and config), virsh help blkdeviotune
+func (as JRPCService) SetBlockIOTune(ctx context.Context, Domain, Device string, Params blockIO) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
@@ -599,7 +788,7 @@ func (as JRPCService) SetAutostart(ctx context.Context, Domain string, Autostart
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	err = setDomainAutostart(ctx, d, Autostart)
+	err = setDomainBlockIOTuneParams(ctx, d, Device, Params)
 	if err != nil {
 		return false, err
 	}
@@ -607,8 +796,8 @@ func (as JRPCService) SetAutostart(ctx context.Context, Domain string, Autostart
 	return true, nil
 }
 
-// Reboot - restarts domain
-func (as JRPCService) Reboot(ctx context.Context, Domain string) (bool, error) {
+// SetBlockIOProfile - sets block device IO tune values for domain from named profile (see ListBlockIOProfiles), live and to persistent config
+func (as JRPCService) SetBlockIOProfile(ctx context.Context, Domain, Device, Profile string) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
@@ -634,7 +823,7 @@ func (as JRPCService) Reboot(ctx context.Context, Domain string) (bool, error) {
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	err = rebootDomain(ctx, d, libvirt.DOMAIN_REBOOT_DEFAULT)
+	err = setDomainBlockIOProfile(ctx, d, Device, Profile)
 	if err != nil {
 		return false, err
 	}
@@ -642,8 +831,13 @@ func (as JRPCService) Reboot(ctx context.Context, Domain string) (bool, error) {
 	return true, nil
 }
 
-// Shutdown - shutdowns domain
-func (as JRPCService) Shutdown(ctx context.Context, Domain string) (bool, error) {
+// ListBlockIOProfiles - returns named block IO profiles used by SetBlockIOProfile
+func (as JRPCService) ListBlockIOProfiles(ctx context.Context) map[string]blockIO {
+	return blockIOProfiles
+}
+
+// SetAutostart - sets autostart action for domain
+func (as JRPCService) SetAutostart(ctx context.Context, Domain string, Autostart bool) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
@@ -669,7 +863,7 @@ func (as JRPCService) Shutdown(ctx context.Context, Domain string) (bool, error)
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	err = shutdownDomain(ctx, d, libvirt.DOMAIN_SHUTDOWN_DEFAULT)
+	err = setDomainAutostart(ctx, d, Autostart)
 	if err != nil {
 		return false, err
 	}
@@ -677,8 +871,8 @@ func (as JRPCService) Shutdown(ctx context.Context, Domain string) (bool, error)
 	return true, nil
 }
 
-// Reset - resets domain
-func (as JRPCService) Reset(ctx context.Context, Domain string) (bool, error) {
+// Reboot - restarts domain
+func (as JRPCService) Reboot(ctx context.Context, Domain string) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
@@ -704,7 +898,7 @@ func (as JRPCService) Reset(ctx context.Context, Domain string) (bool, error) {
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	err = resetDomain(ctx, d)
+	err = rebootDomain(ctx, d, libvirt.DOMAIN_REBOOT_DEFAULT)
 	if err != nil {
 		return false, err
 	}
@@ -712,8 +906,8 @@ func (as JRPCService) Reset(ctx context.Context, Domain string) (bool, error) {
 	return true, nil
 }
 
-// Start - starts domain
-func (as JRPCService) Start(ctx context.Context, Domain string) (bool, error) {
+// Shutdown - shutdowns domain
+func (as JRPCService) Shutdown(ctx context.Context, Domain string) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
@@ -739,7 +933,7 @@ func (as JRPCService) Start(ctx context.Context, Domain string) (bool, error) {
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	err = startDomain(ctx, d)
+	err = shutdownDomain(ctx, d, libvirt.DOMAIN_SHUTDOWN_DEFAULT)
 	if err != nil {
 		return false, err
 	}
@@ -747,56 +941,57 @@ func (as JRPCService) Start(ctx context.Context, Domain string) (bool, error) {
 	return true, nil
 }
 
-// Destroy - destroys domain
-func (as JRPCService) Destroy(ctx context.Context, Domain string) (bool, error) {
+// ShutdownAndWait - shutdowns domain using Guest Agent or ACPI and waits for it to become inactive, optionally powers it off on timeout, Method is empty when domain stopped although shutdown requests failed
+func (as JRPCService) ShutdownAndWait(ctx context.Context, Domain string, TimeoutSec uint, Force bool) (ShutdownResponse, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
-		return false, errors.New("thread safety lock, function is temporarily unavailable")
+		return ShutdownResponse{}, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	if TimeoutSec == 0 {
+		TimeoutSec = 120
 	}
 
 	c, err := openConnection(ctx, "rw")
 	if err != nil {
-		return false, err
+		return ShutdownResponse{}, err
 	}
 	defer closeConnection(ctx, c)
 
 	d, err := lookupDomainByName(ctx, c, Domain)
 	if err != nil {
-		return false, err
+		return ShutdownResponse{}, err
 	}
 	defer freeDomain(ctx, d)
 
 	isActive := isDomainActive(ctx, d)
-	if isActive {
-		return false, errors.New("domain must not be active while being destroyed")
+	if !isActive {
+		return ShutdownResponse{}, errors.New("domain must be active while being shutdown")
 	}
 
 	ok, err := isDomainBlockJobRunning(ctx, d)
 	if err != nil {
-		return false, err
+		return ShutdownResponse{}, err
 	}
 	if ok {
-		return false, errors.New("sanity lock, block device job is currently in process")
+		return ShutdownResponse{}, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
-	if err != nil {
-		return false, err
-	}
-	if ok {
-		return false, errors.New("sanity lock, domain has unfinished internal backup")
-	}
+	t := time.Now()
 
-	err = destroyDomain(ctx, d, libvirt.DOMAIN_DESTROY_GRACEFUL)
+	method, err := shutdownDomainAndWait(ctx, d, time.Duration(TimeoutSec)*time.Second, Force)
 	if err != nil {
-		return false, err
+		return ShutdownResponse{}, err
 	}
 
-	return true, nil
+	return ShutdownResponse{
+		Method:   method,
+		Duration: time.Since(t).Seconds(),
+	}, nil
 }
 
-// MakeSnapshot - makes snapshot of not active (shutdown) domain
-func (as JRPCService) MakeSnapshot(ctx context.Context, Domain string, Name string) (bool, error) {
+// Reset - resets domain
+func (as JRPCService) Reset(ctx context.Context, Domain string) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
@@ -814,11 +1009,6 @@ func (as JRPCService) MakeSnapshot(ctx context.Context, Domain string, Name stri
 	}
 	defer freeDomain(ctx, d)
 
-	isActive := isDomainActive(ctx, d)
-	if isActive {
-		return false, errors.New("domain must not be active while creating internal snapshot")
-	}
-
 	ok, err := isDomainBlockJobRunning(ctx, d)
 	if err != nil {
 		return false, err
@@ -827,31 +1017,16 @@ func (as JRPCService) MakeSnapshot(ctx context.Context, Domain string, Name stri
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
-	if err != nil {
-		return false, err
-	}
-	if ok {
-		return false, errors.New("sanity lock, domain has unfinished internal backup")
-	}
-
-	xml, err := prepareXMLForSnapshot(ctx, d, Name, true)
+	err = resetDomain(ctx, d)
 	if err != nil {
 		return false, err
 	}
 
-	flags := libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC | libvirt.DOMAIN_SNAPSHOT_CREATE_HALT
-
-	ok, err = makeDomainSnapshot(ctx, d, flags, xml)
-	if err != nil || !ok {
-		return false, err
-	}
-
 	return true, nil
 }
 
-// RemoveSnapshot - deletes snapshot of not active (shutdown) domain
-func (as JRPCService) RemoveSnapshot(ctx context.Context, Domain string, Name string) (bool, error) {
+// Start - starts domain
+func (as JRPCService) Start(ctx context.Context, Domain string) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
@@ -869,11 +1044,6 @@ func (as JRPCService) RemoveSnapshot(ctx context.Context, Domain string, Name st
 	}
 	defer freeDomain(ctx, d)
 
-	isActive := isDomainActive(ctx, d)
-	if isActive {
-		return false, errors.New("domain must not be active while deleting snapshot")
-	}
-
 	ok, err := isDomainBlockJobRunning(ctx, d)
 	if err != nil {
 		return false, err
@@ -882,39 +1052,16 @@ func (as JRPCService) RemoveSnapshot(ctx context.Context, Domain string, Name st
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	err = startDomain(ctx, d)
 	if err != nil {
 		return false, err
 	}
-	if ok {
-		return false, errors.New("sanity lock, domain has unfinished internal backup")
-	}
-
-	s, err := lookupDomainSnapshotByName(ctx, d, Name)
-
-	defer func() {
-		id := getReqIDFromContext(ctx)
-
-		err = freeSnapshot(ctx, s)
-		if err != nil {
-			fail.Printf("%sfailed in defer: %s", id, err.Error())
-		}
-	}()
-
-	if err != nil || s == nil {
-		return false, err
-	}
-
-	ok, err = deleteSnapshot(ctx, s, 0)
-	if err != nil || !ok {
-		return false, err
-	}
 
 	return true, nil
 }
 
-// RevertToSnapshot - reverts not active domain to specified snapshot
-func (as JRPCService) RevertToSnapshot(ctx context.Context, Domain string, Name string) (bool, error) {
+// Suspend - suspends (pauses) all domain vCPUs, domain memory is kept allocated
+func (as JRPCService) Suspend(ctx context.Context, Domain string) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
@@ -933,8 +1080,8 @@ func (as JRPCService) RevertToSnapshot(ctx context.Context, Domain string, Name
 	defer freeDomain(ctx, d)
 
 	isActive := isDomainActive(ctx, d)
-	if isActive {
-		return false, errors.New("domain must not be active while reverting to snapshot")
+	if !isActive {
+		return false, errors.New("domain must be active while being suspended")
 	}
 
 	ok, err := isDomainBlockJobRunning(ctx, d)
@@ -945,68 +1092,101 @@ func (as JRPCService) RevertToSnapshot(ctx context.Context, Domain string, Name
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	err = suspendDomain(ctx, d)
 	if err != nil {
 		return false, err
 	}
-	if ok {
-		return false, errors.New("sanity lock, domain has unfinished internal backup")
-	}
 
-	s, err := lookupDomainSnapshotByName(ctx, d, Name)
-	if err != nil || s == nil {
+	return true, nil
+}
+
+// Resume - resumes previously suspended domain
+func (as JRPCService) Resume(ctx context.Context, Domain string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
 		return false, err
 	}
+	defer closeConnection(ctx, c)
 
-	ok, err = revertToSnapshot(ctx, s)
-	if err != nil || !ok {
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
 		return false, err
 	}
+	defer freeDomain(ctx, d)
 
-	return true, nil
-}
+	isActive := isDomainActive(ctx, d)
+	if !isActive {
+		return false, errors.New("domain must be active while being resumed")
+	}
 
-/*
-HowTo:
-  http://wiki.libvirt.org/page/Live-disk-backup-with-active-blockcommit
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
 
-get active disk list:
-  virsh domblklist --domain ubuntu-16.04
+	err = resumeDomain(ctx, d)
+	if err != nil {
+		return false, err
+	}
 
-create external snapshot:
-  virsh snapshot-create-as --domain ubuntu-16.04 --name external.snapshot --disk-only --atomic --quiesce --no-metadata
+	return true, nil
+}
 
-get active disk list after snapshot, external snapshot should be active:
-  virsh domblklist --domain ubuntu-16.04
+// ManagedSave - saves domain memory state to managed save image and stops domain, next Start restores it
+func (as JRPCService) ManagedSave(ctx context.Context, Domain string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
 
-manually backup original active iimage file:
-  cp /var/lib/libvirt/images/ubuntu-16.04.qcow2 /var/lib/libvirt/images/ubuntu-16.04.backup.qcow2
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
 
-check image info:
-  /usr/bin/qemu-img info /var/lib/libvirt/images/ubuntu-16.04.backup.qcow2
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
 
-merge changes back:
-  virsh blockcommit --domain ubuntu-16.04 --path /var/lib/libvirt/images/ubuntu-16.04.external.snapshot --active --verbose --pivot
+	isActive := isDomainActive(ctx, d)
+	if !isActive {
+		return false, errors.New("domain must be active while saving state to managed save image")
+	}
 
-get active disk list after merge, original disk should be active:
-  virsh domblklist --domain ubuntu-16.04
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
 
-view block job info for debug:
-  virsh blockjob --domain ubuntu-16.04 --info --path /var/lib/libvirt/images/ubuntu-16.04.external.snapshot.qcow2
+	err = managedSaveDomain(ctx, d, libvirt.DomainSaveRestoreFlags(0))
+	if err != nil {
+		return false, err
+	}
 
-manually pivot disk after successful 1st stage of block commit, need only for API debug
-  virsh blockjob --domain ubuntu-16.04 --pivot --path sda
-*/
+	return true, nil
+}
 
-// MakeBackup - makes backup using external snapshot and blockcommit for active domain
-func (as JRPCService) MakeBackup(ctx context.Context, Domain string) (bool, error) {
+// ManagedSaveRemove - removes managed save image, next Start boots domain from scratch
+func (as JRPCService) ManagedSaveRemove(ctx context.Context, Domain string) (bool, error) {
 	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
 	}
 
-	id := getReqIDFromContext(ctx)
-
 	c, err := openConnection(ctx, "rw")
 	if err != nil {
 		return false, err
@@ -1020,8 +1200,13 @@ func (as JRPCService) MakeBackup(ctx context.Context, Domain string) (bool, erro
 	defer freeDomain(ctx, d)
 
 	isActive := isDomainActive(ctx, d)
-	if !isActive {
-		return false, errors.New("domain must be active while creating backup")
+	if isActive {
+		return false, errors.New("domain must not be active while removing managed save image")
+	}
+
+	hasImage := isDomainHasManagedSaveImage(ctx, d)
+	if !hasImage {
+		return false, errors.New("domain has no managed save image")
 	}
 
 	ok, err := isDomainBlockJobRunning(ctx, d)
@@ -1032,88 +1217,120 @@ func (as JRPCService) MakeBackup(ctx context.Context, Domain string) (bool, erro
 		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	err = removeDomainManagedSaveImage(ctx, d)
 	if err != nil {
 		return false, err
 	}
-	if ok {
-		return false, errors.New("sanity lock, domain has unfinished backup")
+
+	return true, nil
+}
+
+// Save - saves domain memory state to file inside storage pool specified by name and stops domain
+func (as JRPCService) Save(ctx context.Context, Domain, Storage, Name string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
 	}
 
-	xml, err := prepareXMLForSnapshot(ctx, d, "external.snapshot.qcow2", false)
+	c, err := openConnection(ctx, "rw")
 	if err != nil {
 		return false, err
 	}
+	defer closeConnection(ctx, c)
 
-	paths, err := getDomainBlockDeviceNamesOrPaths(ctx, d, true)
+	d, err := lookupDomainByName(ctx, c, Domain)
 	if err != nil {
 		return false, err
 	}
+	defer freeDomain(ctx, d)
 
-	flags := libvirt.DOMAIN_SNAPSHOT_CREATE_DISK_ONLY |
-		libvirt.DOMAIN_SNAPSHOT_CREATE_QUIESCE |
-		libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC |
-		libvirt.DOMAIN_SNAPSHOT_CREATE_NO_METADATA
+	isActive := isDomainActive(ctx, d)
+	if !isActive {
+		return false, errors.New("domain must be active while saving state to file")
+	}
 
-	ok, err = makeDomainSnapshot(ctx, d, flags, xml)
-	if err != nil || !ok {
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
 		return false, err
 	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
 
-	for _, path := range paths {
-		err := createBackup(ctx, c, path)
-		if err != nil {
-			return false, err
-		}
+	path, err := getPoolFilePath(ctx, c, Storage, Name)
+	if err != nil {
+		return false, err
 	}
 
-	disks, err := getDomainBlockDeviceNamesOrPaths(ctx, d, false)
+	vol, err := lookupStorageVolByPath(ctx, c, path)
+	if err == nil {
+		freeVolume(ctx, vol)
+		return false, fmt.Errorf("file: %s exists", path)
+	}
+
+	err = saveDomain(ctx, d, path, libvirt.DomainSaveRestoreFlags(0))
 	if err != nil {
 		return false, err
 	}
 
-	paths, err = getDomainBlockDeviceNamesOrPaths(ctx, d, true)
+	// saved state is kept until it is deleted by DeleteVolume
+	err = addBackupCatalogEntry(ctx, path, backupKindSavedState, Domain)
 	if err != nil {
 		return false, err
 	}
 
-	for _, disk := range disks {
-		ok, err := blockCommitActive(ctx, d, disk)
-		if err != nil || !ok {
-			return false, err
-		}
+	err = refreshAllStorgePools(ctx, c)
+	if err != nil {
+		return false, err
+	}
 
-		ok = waitBlockCommitActive(ctx, d, disk)
-		if !ok {
-			continue
-		}
+	return true, nil
+}
 
-		ok, err = blockCommitActivePivot(ctx, d, disk)
-		if err != nil || !ok {
-			return false, err
-		}
+// Restore - restores domain memory state from file inside storage pool specified by name
+func (as JRPCService) Restore(ctx context.Context, Storage, Name string) (bool, error) {
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
 	}
+	defer closeConnection(ctx, c)
 
-	err = deleteTemporaryExternalSnapshot(ctx, c, paths)
+	path, err := getPoolFilePath(ctx, c, Storage, Name)
 	if err != nil {
 		return false, err
 	}
 
-	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	Domain, err := getDomainNameFromSaveImage(ctx, c, path)
 	if err != nil {
 		return false, err
 	}
-	if ok {
-		return false, errors.New("T_T domain backup job failed miserably")
+
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err == nil {
+		defer freeDomain(ctx, d)
+
+		isActive := isDomainActive(ctx, d)
+		if isActive {
+			return false, errors.New("domain must not be active while restoring state from file")
+		}
+	}
+
+	err = restoreDomain(ctx, c, path, libvirt.DomainSaveRestoreFlags(0))
+	if err != nil {
+		return false, err
 	}
 
-	info.Printf("%s^_^ domain backup job magically succeeded\n", id)
 	return true, nil
 }
 
-// CloneImage - clones image from (left) volume name to new (right) volume name inside storage pool specified by name
-func (as JRPCService) CloneImage(ctx context.Context, Storage, LeftImageName, RightImageName string) (bool, error) {
-	isLocked := isLockedAndMakeLock(ctx, fmt.Sprintf("%s|%s", Storage, LeftImageName), 60)
+// PowerOff - powers off (pulls the plug) active domain, domain definition and disks are kept
+func (as JRPCService) PowerOff(ctx context.Context, Domain string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
 	}
@@ -1124,12 +1341,26 @@ func (as JRPCService) CloneImage(ctx context.Context, Storage, LeftImageName, Ri
 	}
 	defer closeConnection(ctx, c)
 
-	err = refreshAllStorgePools(ctx, c)
+	d, err := lookupDomainByName(ctx, c, Domain)
 	if err != nil {
 		return false, err
 	}
+	defer freeDomain(ctx, d)
 
-	err = cloneVolumeByPath(ctx, c, Storage, LeftImageName, RightImageName)
+	isActive := isDomainActive(ctx, d)
+	if !isActive {
+		return false, errors.New("domain must be active while being powered off")
+	}
+
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
+
+	_, err = powerOffDomain(ctx, d)
 	if err != nil {
 		return false, err
 	}
@@ -1137,14 +1368,9 @@ func (as JRPCService) CloneImage(ctx context.Context, Storage, LeftImageName, Ri
 	return true, nil
 }
 
-// Create - creates new domain with supplied configuration
-func (as JRPCService) Create(ctx context.Context, UUID, Name string, VCPU int, Memory uint, Storage, Template, Network, MAC string, VLAN uint) (bool, error) {
-	maxMemory := 2 * Memory
-	maxVcpus := 16
-
-	id := getReqIDFromContext(ctx)
-
-	isLocked := isLockedAndMakeLock(ctx, "Local Hypervisor", 60)
+// Delete - undefines not active domain, backups and removes its disks unless told otherwise
+func (as JRPCService) Delete(ctx context.Context, Domain string, KeepDisks, SkipBackup bool) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
 	if isLocked {
 		return false, errors.New("thread safety lock, function is temporarily unavailable")
 	}
@@ -1155,41 +1381,1413 @@ func (as JRPCService) Create(ctx context.Context, UUID, Name string, VCPU int, M
 	}
 	defer closeConnection(ctx, c)
 
-	if len(UUID) == 0 {
-		UUID = genUUID(ctx)
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	isActive := isDomainActive(ctx, d)
+	if isActive {
+		return false, errors.New("domain must not be active while being deleted")
 	}
 
-	ok, err := validateCreateDomain(ctx, c, UUID, Name, VCPU, Memory, Storage, Template, Network, MAC) // no VLAN validation
+	ok, err := isDomainBlockJobRunning(ctx, d)
 	if err != nil {
-		fail.Printf("%sfailed to validate domain options: %s\n", id, err.Error())
-		return false, fmt.Errorf("failed to validate domain options: %s", err.Error())
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
 	}
 
-	if !ok {
-		fail.Printf("%sfailed to validate domain options\n", id)
-		return false, fmt.Errorf("failed to validate domain options")
+	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, domain has unfinished internal backup")
 	}
 
-	xml, err := prepareXMLforNewDomain(ctx, c, UUID, Name, VCPU, maxVcpus, Memory, maxMemory, Storage, Network, MAC, VLAN)
+	err = deleteDomain(ctx, d, libvirt.DOMAIN_DESTROY_GRACEFUL, KeepDisks, SkipBackup)
 	if err != nil {
 		return false, err
 	}
 
-	err = cloneVolumeByPath(ctx, c, Storage, Template, fmt.Sprintf("%s.qcow2", Name))
+	return true, nil
+}
+
+// MakeSnapshot - makes snapshot of not active (shutdown) domain
+func (as JRPCService) MakeSnapshot(ctx context.Context, Domain string, Name string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
 	if err != nil {
 		return false, err
 	}
+	defer closeConnection(ctx, c)
 
-	dom, err := c.DomainDefineXMLFlags(xml, libvirt.DOMAIN_DEFINE_VALIDATE)
+	d, err := lookupDomainByName(ctx, c, Domain)
 	if err != nil {
-		fail.Printf("%sfailed to define domain: %s using XML: %s\n", id, Name, err.Error())
 		return false, err
 	}
-	defer freeDomain(ctx, dom)
+	defer freeDomain(ctx, d)
 
-	info.Printf("%sdefined domain: %s\n", id, Name)
+	isActive := isDomainActive(ctx, d)
+	if isActive {
+		return false, errors.New("domain must not be active while creating internal snapshot")
+	}
 
-	return true, nil
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
+
+	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, domain has unfinished internal backup")
+	}
+
+	xml, err := prepareXMLForSnapshot(ctx, d, Name, true)
+	if err != nil {
+		return false, err
+	}
+
+	flags := libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC | libvirt.DOMAIN_SNAPSHOT_CREATE_HALT
+
+	ok, err = makeDomainSnapshot(ctx, d, flags, xml)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RemoveSnapshot - deletes snapshot of not active (shutdown) domain
+func (as JRPCService) RemoveSnapshot(ctx context.Context, Domain string, Name string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	isActive := isDomainActive(ctx, d)
+	if isActive {
+		return false, errors.New("domain must not be active while deleting snapshot")
+	}
+
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
+
+	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, domain has unfinished internal backup")
+	}
+
+	s, err := lookupDomainSnapshotByName(ctx, d, Name)
+
+	defer func() {
+		id := getReqIDFromContext(ctx)
+
+		err = freeSnapshot(ctx, s)
+		if err != nil {
+			fail.Printf("%sfailed in defer: %s", id, err.Error())
+		}
+	}()
+
+	if err != nil || s == nil {
+		return false, err
+	}
+
+	ok, err = deleteSnapshot(ctx, s, 0)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RevertToSnapshot - reverts not active domain to specified snapshot
+func (as JRPCService) RevertToSnapshot(ctx context.Context, Domain string, Name string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	isActive := isDomainActive(ctx, d)
+	if isActive {
+		return false, errors.New("domain must not be active while reverting to snapshot")
+	}
+
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
+
+	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, domain has unfinished internal backup")
+	}
+
+	s, err := lookupDomainSnapshotByName(ctx, d, Name)
+	if err != nil || s == nil {
+		return false, err
+	}
+
+	ok, err = revertToSnapshot(ctx, s)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, nil
+}
+
+/*
+HowTo:
+  http://wiki.libvirt.org/page/Live-disk-backup-with-active-blockcommit
+
+get active disk list:
+  virsh domblklist --domain ubuntu-16.04
+
+create external snapshot:
+  virsh snapshot-create-as --domain ubuntu-16.04 --name external.snapshot --disk-only --atomic --quiesce --no-metadata
+
+get active disk list after snapshot, external snapshot should be active:
+  virsh domblklist --domain ubuntu-16.04
+
+manually backup original active iimage file:
+  cp /var/lib/libvirt/images/ubuntu-16.04.qcow2 /var/lib/libvirt/images/ubuntu-16.04.backup.qcow2
+
+check image info:
+  /usr/bin/qemu-img info /var/lib/libvirt/images/ubuntu-16.04.backup.qcow2
+
+merge changes back:
+  virsh blockcommit --domain ubuntu-16.04 --path /var/lib/libvirt/images/ubuntu-16.04.external.snapshot --active --verbose --pivot
+
+get active disk list after merge, original disk should be active:
+  virsh domblklist --domain ubuntu-16.04
+
+view block job info for debug:
+  virsh blockjob --domain ubuntu-16.04 --info --path /var/lib/libvirt/images/ubuntu-16.04.external.snapshot.qcow2
+
+manually pivot disk after successful 1st stage of block commit, need only for API debug
+  virsh blockjob --domain ubuntu-16.04 --pivot --path sda
+*/
+
+// MakeBackup - makes backup using external snapshot and blockcommit for active domain
+func (as JRPCService) MakeBackup(ctx context.Context, Domain string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	id := getReqIDFromContext(ctx)
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	isActive := isDomainActive(ctx, d)
+	if !isActive {
+		return false, errors.New("domain must be active while creating backup")
+	}
+
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
+
+	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, domain has unfinished backup")
+	}
+
+	xml, err := prepareXMLForSnapshot(ctx, d, "external.snapshot.qcow2", false)
+	if err != nil {
+		return false, err
+	}
+
+	paths, err := getDomainBlockDeviceNamesOrPaths(ctx, d, true)
+	if err != nil {
+		return false, err
+	}
+
+	flags := libvirt.DOMAIN_SNAPSHOT_CREATE_DISK_ONLY |
+		libvirt.DOMAIN_SNAPSHOT_CREATE_QUIESCE |
+		libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC |
+		libvirt.DOMAIN_SNAPSHOT_CREATE_NO_METADATA
+
+	ok, err = makeDomainSnapshot(ctx, d, flags, xml)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	for _, path := range paths {
+		err := createBackup(ctx, c, path)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	disks, err := getDomainBlockDeviceNamesOrPaths(ctx, d, false)
+	if err != nil {
+		return false, err
+	}
+
+	paths, err = getDomainBlockDeviceNamesOrPaths(ctx, d, true)
+	if err != nil {
+		return false, err
+	}
+
+	for _, disk := range disks {
+		ok, err := blockCommitActive(ctx, d, disk)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		ok = waitBlockCommitActive(ctx, d, disk)
+		if !ok {
+			continue
+		}
+
+		ok, err = blockCommitActivePivot(ctx, d, disk)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	err = deleteTemporaryExternalSnapshot(ctx, c, paths)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err = isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("T_T domain backup job failed miserably")
+	}
+
+	info.Printf("%s^_^ domain backup job magically succeeded\n", id)
+	return true, nil
+}
+
+// CloneImage - clones image from (left) volume name to new (right) volume name inside storage pool specified by name
+func (as JRPCService) CloneImage(ctx context.Context, Storage, LeftImageName, RightImageName string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, fmt.Sprintf("%s|%s", Storage, LeftImageName), 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	err = refreshAllStorgePools(ctx, c)
+	if err != nil {
+		return false, err
+	}
+
+	err = cloneVolumeByPath(ctx, c, Storage, LeftImageName, RightImageName)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// FlattenVolume - detaches linked clone from its base volume, block pull job is started when volume is used by running domain, otherwise volume is rebased offline
+func (as JRPCService) FlattenVolume(ctx context.Context, Pool, Name string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Pool+"/"+Name, 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	err = flattenPoolVolume(ctx, c, Pool, Name)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// FindOrphans - lists volumes of all active storage pools not referenced by any domain, linked clone, template catalog or backup catalog (backups, saved states and data volumes), ISO volumes, targets of running imports and unfinished chunked uploads are not listed
+func (as JRPCService) FindOrphans(ctx context.Context) ([]OrphanVolume, error) {
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnection(ctx, c)
+
+	return findOrphanVolumes(ctx, c)
+}
+
+// CollectOrphans - removes orphaned volumes not modified for at least MinAge seconds, volumes of unknown age are removed only with RemoveUnknownAge, DryRun only lists them
+func (as JRPCService) CollectOrphans(ctx context.Context, DryRun bool, MinAge uint64, RemoveUnknownAge bool) ([]OrphanVolume, error) {
+	isLocked := isLockedAndMakeLock(ctx, "Local Hypervisor", 60)
+	if isLocked {
+		return nil, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnection(ctx, c)
+
+	return collectOrphanVolumes(ctx, c, DryRun, MinAge, RemoveUnknownAge)
+}
+
+// ImportDisk - converts disk image (raw, qcow2, vmdk, vhdx, vpc, vdi) from file inside import directory or <pool>/<volume> to qcow2 volume as background job, non-empty Domain gets volume attached, RegisterTemplate registers volume in template catalog
+func (as JRPCService) ImportDisk(ctx context.Context, Pool, SourcePath, Format, TargetName, Domain string, RegisterTemplate bool) (ImportJobStatus, error) {
+	isLocked := isLockedAndMakeLock(ctx, Pool+"/"+TargetName, 10)
+	if isLocked {
+		return ImportJobStatus{}, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return ImportJobStatus{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	return startImportJob(ctx, c, Pool, SourcePath, Format, TargetName, Domain, RegisterTemplate)
+}
+
+// GetImportJob - returns state and progress of import job
+func (as JRPCService) GetImportJob(ctx context.Context, ID string) (ImportJobStatus, error) {
+	return getImportJob(ctx, ID)
+}
+
+// ListImportJobs - lists import jobs started since service start
+func (as JRPCService) ListImportJobs(ctx context.Context) []ImportJobStatus {
+	return listImportJobs()
+}
+
+// AttachDisk - attaches volume of storage pool as disk on next free target device of Bus, live and to persistent config, nil IOTune applies default limits
+func (as JRPCService) AttachDisk(ctx context.Context, Domain, Pool, Volume, Bus, Cache string, IOTune *blockIO) (string, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return "", errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return "", err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return "", err
+	}
+	defer freeDomain(ctx, d)
+
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return "", errors.New("sanity lock, block device job is currently in process")
+	}
+
+	if len(Bus) == 0 {
+		Bus = "scsi"
+	}
+
+	if len(Cache) == 0 {
+		Cache = "directsync"
+	}
+
+	return attachDisk(ctx, c, d, Pool, Volume, Bus, Cache, IOTune)
+}
+
+// DetachDisk - detaches disk with target device name live and from persistent config, volume is kept in storage pool
+func (as JRPCService) DetachDisk(ctx context.Context, Domain, TargetDev string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
+
+	err = detachDisk(ctx, d, TargetDev)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// InsertMedia - inserts ISO volume of storage pool into domain CD-ROM drive, drive is added to shut off domain if missing
+func (as JRPCService) InsertMedia(ctx context.Context, Domain, Pool, ISO string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
+
+	err = insertDomainMedia(ctx, c, d, Pool, ISO)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// EjectMedia - ejects media from domain CD-ROM drive, drive itself is kept
+func (as JRPCService) EjectMedia(ctx context.Context, Domain string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	ok, err := isDomainBlockJobRunning(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, block device job is currently in process")
+	}
+
+	err = ejectDomainMedia(ctx, d)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetBootOrder - sets boot devices order (hd, cdrom, network) of persistent config, takes effect on next domain start
+func (as JRPCService) SetBootOrder(ctx context.Context, Domain string, Order []string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	err = setDomainBootOrder(ctx, c, d, Order)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ListPools - lists storage pools of all types
+func (as JRPCService) ListPools(ctx context.Context) ([]nodePool, error) {
+	c, err := openConnection(ctx, "ro")
+	if err != nil {
+		return []nodePool{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	return getNodePools(ctx, c)
+}
+
+// DefinePool - defines persistent storage pool (dir, logical, netfs, rbd, iscsi) from spec, optionally builds, starts and marks it autostarted
+func (as JRPCService) DefinePool(ctx context.Context, Spec PoolSpec) (bool, error) {
+	id := getReqIDFromContext(ctx)
+
+	isLocked := isLockedAndMakeLock(ctx, Spec.Name, 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	problems := validatePoolSpec(ctx, c, &Spec)
+	if len(problems) != 0 {
+		msgs := make([]string, 0, len(problems))
+		for _, p := range problems {
+			msgs = append(msgs, p.Error())
+		}
+
+		fail.Printf("%sfailed to validate pool spec: %s\n", id, strings.Join(msgs, "; "))
+		return false, fmt.Errorf("failed to validate pool spec: %s", strings.Join(msgs, "; "))
+	}
+
+	err = definePoolFromSpec(ctx, c, &Spec)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// BuildPool - builds underlying storage of inactive storage pool (creates directory, volume group, ...)
+func (as JRPCService) BuildPool(ctx context.Context, Pool string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Pool, 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	p, err := lookupPoolByName(ctx, c, Pool)
+	if err != nil {
+		return false, err
+	}
+	defer freePool(ctx, p)
+
+	err = buildPool(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// StartPool - starts (activates) storage pool
+func (as JRPCService) StartPool(ctx context.Context, Pool string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Pool, 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	p, err := lookupPoolByName(ctx, c, Pool)
+	if err != nil {
+		return false, err
+	}
+	defer freePool(ctx, p)
+
+	err = startPool(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// StopPool - stops (deactivates) storage pool, data is kept
+func (as JRPCService) StopPool(ctx context.Context, Pool string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Pool, 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	p, err := lookupPoolByName(ctx, c, Pool)
+	if err != nil {
+		return false, err
+	}
+	defer freePool(ctx, p)
+
+	err = stopPool(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetPoolAutostart - sets autostart of storage pool on libvirt daemon start
+func (as JRPCService) SetPoolAutostart(ctx context.Context, Pool string, Autostart bool) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Pool, 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	p, err := lookupPoolByName(ctx, c, Pool)
+	if err != nil {
+		return false, err
+	}
+	defer freePool(ctx, p)
+
+	err = setPoolAutostart(ctx, p, Autostart)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UndefinePool - undefines stopped storage pool, DeleteStorage also removes underlying storage (directory, volume group)
+func (as JRPCService) UndefinePool(ctx context.Context, Pool string, DeleteStorage bool) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Pool, 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	p, err := lookupPoolByName(ctx, c, Pool)
+	if err != nil {
+		return false, err
+	}
+	defer freePool(ctx, p)
+
+	err = undefinePool(ctx, p, DeleteStorage)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ListImageTemplates - lists templates registered in catalog of storage pool together with volumes named as templates
+func (as JRPCService) ListImageTemplates(ctx context.Context, Pool string) ([]ImageTemplate, error) {
+	c, err := openConnection(ctx, "ro")
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnection(ctx, c)
+
+	return listImageTemplates(ctx, c, Pool)
+}
+
+// RegisterImageTemplate - registers volume of storage pool in template catalog, checksum of volume is computed and compared with supplied one
+func (as JRPCService) RegisterImageTemplate(ctx context.Context, Pool string, Template ImageTemplate) (ImageTemplate, error) {
+	isLocked := isLockedAndMakeLock(ctx, Pool+"/"+Template.Name, 10)
+	if isLocked {
+		return ImageTemplate{}, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return ImageTemplate{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	return registerImageTemplate(ctx, c, Pool, Template)
+}
+
+// VerifyImageTemplate - recomputes checksum of registered template and compares it with catalog
+func (as JRPCService) VerifyImageTemplate(ctx context.Context, Pool, Template string) (VerifyImageTemplateResponse, error) {
+	isLocked := isLockedAndMakeLock(ctx, Pool+"/"+Template, 10)
+	if isLocked {
+		return VerifyImageTemplateResponse{}, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return VerifyImageTemplateResponse{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	return verifyImageTemplate(ctx, c, Pool, Template)
+}
+
+// ListVolumes - refreshes storage pool and lists its volumes with capacity, allocation, format, backing store and domains using them (disks and CD-ROMs)
+func (as JRPCService) ListVolumes(ctx context.Context, Pool string) ([]VolumeInfoResponse, error) {
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return []VolumeInfoResponse{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	return listPoolVolumesInfo(ctx, c, Pool)
+}
+
+// VolumeInfo - acquires info of single volume inside storage pool
+func (as JRPCService) VolumeInfo(ctx context.Context, Pool, Name string) (VolumeInfoResponse, error) {
+	c, err := openConnection(ctx, "ro")
+	if err != nil {
+		return VolumeInfoResponse{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	v, err := lookupPoolVolume(ctx, c, Pool, Name)
+	if err != nil {
+		return VolumeInfoResponse{}, err
+	}
+	defer freeVolume(ctx, v)
+
+	users, err := getDomainsDiskPaths(ctx, c)
+	if err != nil {
+		return VolumeInfoResponse{}, err
+	}
+
+	return getVolumeInfoResponse(ctx, v, users)
+}
+
+// CreateVolume - creates new empty volume [bytes] inside storage pool, Format is qcow2 (default) or raw, volume is recorded in backup catalog and is not collected as orphan
+func (as JRPCService) CreateVolume(ctx context.Context, Pool, Name string, Size uint64, Format string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, fmt.Sprintf("%s|%s", Pool, Name), 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	if len(Format) == 0 {
+		Format = volumeFormatQcow2
+	}
+
+	if !isStringInSlice(Format, volumeFormats) {
+		return false, fmt.Errorf("unknown volume format: %s, supported: %s", Format, strings.Join(volumeFormats, ", "))
+	}
+
+	if Size == 0 {
+		return false, errors.New("volume size must be positive")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	err = createPoolVolume(ctx, c, Pool, Name, Size, Format)
+	if err != nil {
+		return false, err
+	}
+
+	path, err := getPoolFilePath(ctx, c, Pool, Name)
+	if err != nil {
+		return false, err
+	}
+
+	// data volume is kept until it is deleted by DeleteVolume, also while it is not attached
+	err = addBackupCatalogEntry(ctx, path, backupKindDataVolume, Pool)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DeleteVolume - deletes volume from storage pool, volume used by any domain is not deleted
+func (as JRPCService) DeleteVolume(ctx context.Context, Pool, Name string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, fmt.Sprintf("%s|%s", Pool, Name), 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	err = deleteUnusedPoolVolume(ctx, c, Pool, Name)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ResizeVolume - grows volume to new capacity [bytes], shrinking is refused, volume of running domain is resized live
+func (as JRPCService) ResizeVolume(ctx context.Context, Pool, Name string, Size uint64) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, fmt.Sprintf("%s|%s", Pool, Name), 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	if Size == 0 {
+		return false, errors.New("volume size must be positive")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	err = resizePoolVolume(ctx, c, Pool, Name, Size)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Create - creates new domain with supplied configuration from default domain XML template (other templates, cloud-init seed image, tenant and linked clone are set by CreateFromSpec), minimum requirements of Template registered in catalog are applied
+func (as JRPCService) Create(ctx context.Context, UUID, Name string, VCPU int, Memory uint, Storage, Template, Network, MAC string, VLAN uint) (bool, error) {
+	maxMemory := getPolicyMaxMemory(Memory)
+	maxVcpus := policy.MaxVCPUPerVM
+
+	id := getReqIDFromContext(ctx)
+
+	isLocked := isLockedAndMakeLock(ctx, "Local Hypervisor", 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	if len(UUID) == 0 {
+		UUID = genUUID(ctx)
+	}
+
+	ok, err := validateCreateDomain(ctx, c, UUID, Name, VCPU, Memory, Storage, Template, Network, MAC) // no VLAN validation
+	if err != nil {
+		fail.Printf("%sfailed to validate domain options: %s\n", id, err.Error())
+		return false, fmt.Errorf("failed to validate domain options: %s", err.Error())
+	}
+
+	if !ok {
+		fail.Printf("%sfailed to validate domain options\n", id)
+		return false, fmt.Errorf("failed to validate domain options")
+	}
+
+	minDisk, err := checkImageTemplateRequirements(ctx, c, Storage, Template, Memory, false)
+	if err != nil {
+		return false, err
+	}
+
+	xml, err := prepareXMLforNewDomain(ctx, c, UUID, Name, VCPU, maxVcpus, Memory, maxMemory, Storage, Template, Network, MAC, VLAN)
+	if err != nil {
+		return false, err
+	}
+
+	tx := newTransaction(ctx)
+
+	err = txCloneVolume(ctx, tx, c, Storage, Template, getDomainDiskImageName(Name, 0, ""), false)
+	if err != nil {
+		return false, err
+	}
+
+	if minDisk != 0 {
+		err = resizePoolVolume(ctx, c, Storage, getDomainDiskImageName(Name, 0, ""), minDisk)
+		if err != nil {
+			tx.rollback()
+			return false, err
+		}
+	}
+
+	dom, err := txDefineDomain(ctx, tx, c, xml)
+	if err != nil {
+		fail.Printf("%sfailed to define domain: %s using XML: %s\n", id, Name, err.Error())
+		tx.rollback()
+		return false, err
+	}
+	defer freeDomain(ctx, dom)
+
+	info.Printf("%sdefined domain: %s\n", id, Name)
+
+	return true, nil
+}
+
+// DetachCloudInit - detaches cloud-init seed image from domain and removes it from storage pool, meant to be called after first boot
+func (as JRPCService) DetachCloudInit(ctx context.Context, Domain string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	_, err = detachCloudInitSeed(ctx, c, d)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ListTemplates - lists names of domain XML templates available for Create
+func (as JRPCService) ListTemplates(ctx context.Context) ([]string, error) {
+	return listDomainTemplates(ctx)
+}
+
+// RenderTemplate - renders domain XML template with supplied variables without defining domain (dry-run)
+func (as JRPCService) RenderTemplate(ctx context.Context, Template string, Vars DomainTemplateVars) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	domCfg, err := renderDomainTemplate(ctx, Template, Vars)
+	if err != nil {
+		return "", err
+	}
+
+	xml, err := domCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal domain XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	return xml, nil
+}
+
+// PlanCreate - dry-run of Create, reports result of every check with measured values, generated domain XML, image path and VF, nothing is changed
+func (as JRPCService) PlanCreate(ctx context.Context, UUID, Name string, VCPU int, Memory uint, Storage, Template, Network, MAC string, VLAN uint) (PlanCreateResponse, error) {
+	maxMemory := getPolicyMaxMemory(Memory)
+	maxVcpus := policy.MaxVCPUPerVM
+
+	c, err := openConnection(ctx, "ro")
+	if err != nil {
+		return PlanCreateResponse{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	if len(UUID) == 0 {
+		UUID = genUUID(ctx)
+	}
+
+	return planCreateDomain(ctx, c, UUID, Name, VCPU, maxVcpus, Memory, maxMemory, Storage, Template, Network, MAC, VLAN), nil
+}
+
+// TenantUsage - returns current usage of tenant summed from GetAllDomainStats of its domains together with tenant quota
+func (as JRPCService) TenantUsage(ctx context.Context, Tenant string) (TenantUsageResponse, error) {
+	_, err := isTenantNameValid(ctx, Tenant)
+	if err != nil {
+		return TenantUsageResponse{}, err
+	}
+
+	c, err := openConnection(ctx, "ro")
+	if err != nil {
+		return TenantUsageResponse{}, err
+	}
+	defer closeConnection(ctx, c)
+
+	return getTenantUsage(ctx, c, Tenant)
+}
+
+// CreateFromSpec - creates new domain from declarative spec with multiple disks and network interfaces, all spec problems are reported at once
+func (as JRPCService) CreateFromSpec(ctx context.Context, Spec DomainSpec) (bool, error) {
+	id := getReqIDFromContext(ctx)
+
+	isLocked := isLockedAndMakeLock(ctx, "Local Hypervisor", 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	setDomainSpecDefaults(ctx, &Spec)
+	targets := getDomainSpecDiskTargets(&Spec)
+
+	problems := validateDomainSpec(ctx, c, &Spec, targets)
+	if len(problems) != 0 {
+		msgs := make([]string, 0, len(problems))
+		for _, p := range problems {
+			msgs = append(msgs, p.Error())
+		}
+
+		fail.Printf("%sfailed to validate domain spec: %s\n", id, strings.Join(msgs, "; "))
+		return false, fmt.Errorf("failed to validate domain spec: %s", strings.Join(msgs, "; "))
+	}
+
+	err = createDomainFromSpec(ctx, c, &Spec, targets)
+	if err != nil {
+		return false, err
+	}
+
+	info.Printf("%sdefined domain: %s\n", id, Spec.Name)
+
+	return true, nil
+}
+
+// DefineXML - defines new domain from supplied XML, XML is validated by libvirt and by Create rules, tenant in XML metadata is checked against tenant quota
+func (as JRPCService) DefineXML(ctx context.Context, XML string) (bool, error) {
+	id := getReqIDFromContext(ctx)
+
+	isLocked := isLockedAndMakeLock(ctx, "Local Hypervisor", 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	domCfg := &libvirtxml.Domain{}
+	err = domCfg.Unmarshal(XML)
+	if err != nil {
+		fail.Printf("%sfailed to parse domain XML: %s\n", id, err.Error())
+		return false, fmt.Errorf("failed to parse domain XML: %s", err.Error())
+	}
+
+	if len(domCfg.UUID) == 0 {
+		domCfg.UUID = genUUID(ctx)
+	}
+
+	ok, err := validateDefineDomain(ctx, c, domCfg)
+	if err != nil {
+		fail.Printf("%sfailed to validate domain XML: %s\n", id, err.Error())
+		return false, fmt.Errorf("failed to validate domain XML: %s", err.Error())
+	}
+
+	if !ok {
+		fail.Printf("%sfailed to validate domain XML\n", id)
+		return false, fmt.Errorf("failed to validate domain XML")
+	}
+
+	err = checkDomainConfigTenantQuota(ctx, c, domCfg)
+	if err != nil {
+		return false, err
+	}
+
+	xml, err := domCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal domain XML: %s\n", id, err.Error())
+		return false, err
+	}
+
+	d, err := defineDomain(ctx, c, xml)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	info.Printf("%sdefined domain: %s\n", id, domCfg.Name)
+
+	return true, nil
+}
+
+// Undefine - removes not active domain definition, disks are kept
+func (as JRPCService) Undefine(ctx context.Context, Domain string, KeepNVRAM, KeepSnapshotsMetadata bool) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	isActive := isDomainActive(ctx, d)
+	if isActive {
+		return false, errors.New("domain must not be active while being undefined")
+	}
+
+	ok, err := isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, domain has unfinished internal backup")
+	}
+
+	flags := libvirt.DOMAIN_UNDEFINE_MANAGED_SAVE
+
+	if KeepNVRAM {
+		flags = flags | libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM
+	} else {
+		flags = flags | libvirt.DOMAIN_UNDEFINE_NVRAM
+	}
+
+	if !KeepSnapshotsMetadata {
+		flags = flags | libvirt.DOMAIN_UNDEFINE_SNAPSHOTS_METADATA
+	}
+
+	err = undefineDomain(ctx, d, flags)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetXML - acquires domain XML description, optionally inactive (persistent) config and with security sensitive data
+func (as JRPCService) GetXML(ctx context.Context, Domain string, Inactive, Secure bool) (string, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return "", errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	mode := "ro"
+	if Secure {
+		mode = "rw"
+	}
+
+	c, err := openConnection(ctx, mode)
+	if err != nil {
+		return "", err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return "", err
+	}
+	defer freeDomain(ctx, d)
+
+	flags := libvirt.DomainXMLFlags(0)
+
+	if Inactive {
+		flags = flags | libvirt.DOMAIN_XML_INACTIVE
+	}
+
+	if Secure {
+		flags = flags | libvirt.DOMAIN_XML_SECURE
+	}
+
+	return getDomainXML(ctx, d, flags)
+}
+
+// CloneDomain - makes full copy of not active domain with new name, UUID, MAC(s), storage pool disk(s) and NVRAM, cloud-init seed image is not copied, clone keeps tenant of source domain and is checked against tenant quota
+func (as JRPCService) CloneDomain(ctx context.Context, Source, NewName string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, "Local Hypervisor", 60)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Source)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	isActive := isDomainActive(ctx, d)
+	if isActive {
+		return false, errors.New("domain must not be active while being cloned")
+	}
+
+	ok, err := isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, domain has unfinished internal backup")
+	}
+
+	ok, err = isDomainNameValidAndAvailable(ctx, c, NewName)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = refreshAllStorgePools(ctx, c)
+	if err != nil {
+		return false, err
+	}
+
+	err = cloneDomain(ctx, c, d, NewName)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RenameDomain - renames not active domain, disk(s) of file based pools are copied to volumes matching new name, old volumes are removed
+func (as JRPCService) RenameDomain(ctx context.Context, Domain, NewName string) (bool, error) {
+	isLocked := isLockedAndMakeLock(ctx, Domain, 10)
+	if isLocked {
+		return false, errors.New("thread safety lock, function is temporarily unavailable")
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		return false, err
+	}
+	defer closeConnection(ctx, c)
+
+	d, err := lookupDomainByName(ctx, c, Domain)
+	if err != nil {
+		return false, err
+	}
+	defer freeDomain(ctx, d)
+
+	isActive := isDomainActive(ctx, d)
+	if isActive {
+		return false, errors.New("domain must not be active while being renamed")
+	}
+
+	ok, err := isDomainBlockHasActiveExternalBackupSnashot(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		return false, errors.New("sanity lock, domain has unfinished internal backup")
+	}
+
+	ok, err = isDomainNameValidAndAvailable(ctx, c, NewName)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = renameDomain(ctx, c, d, NewName)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetAdmissionPolicy - returns admission policy used by resource checks
+func (as JRPCService) GetAdmissionPolicy(ctx context.Context) AdmissionPolicy {
+	return policy
 }
 
 // CheckResources - checks if requested resources available on hypervisor
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+)
+
+/* global variable declaration, if any... */
+const (
+	metaLabelsURI = "1c5537ac-8c84-4313-a8e7-9dd8d45ac7ed/labels"
+	metaLabelsKey = "labels"
+)
+
+const (
+	selectorOpEquals       = "="
+	selectorOpNotEquals    = "!="
+	selectorOpIn           = "in"
+	selectorOpNotIn        = "notin"
+	selectorOpExists       = "exists"
+	selectorOpDoesNotExist = "!"
+)
+
+var (
+	labelKeyRegexp   = regexp.MustCompile(`^([a-zA-Z0-9]([-a-zA-Z0-9.]*[a-zA-Z0-9])?/)?[a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?$`)
+	labelValueRegexp = regexp.MustCompile(`^([a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?)?$`)
+)
+
+type labelsMetadata struct {
+	XMLName xml.Name        `xml:"labels"`
+	Labels  []labelMetadata `xml:"label"`
+}
+
+type labelMetadata struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// single requirement of label selector
+type labelRequirement struct {
+	key    string
+	op     string
+	values []string
+}
+
+// labelSelector - all requirements must match, empty selector matches everything
+type labelSelector []labelRequirement
+
+func isLabelKeyValid(key string) error {
+	if len(key) == 0 || len(key) > 253 || !labelKeyRegexp.MatchString(key) {
+		return fmt.Errorf("not valid label key: %s", key)
+	}
+
+	return nil
+}
+
+func isLabelValueValid(value string) error {
+	if len(value) > 63 || !labelValueRegexp.MatchString(value) {
+		return fmt.Errorf("not valid label value: %s", value)
+	}
+
+	return nil
+}
+
+// returns empty map for domain without labels
+func getDomainLabels(ctx context.Context, d *libvirt.Domain) (map[string]string, error) {
+	id := getReqIDFromContext(ctx)
+
+	labels := make(map[string]string)
+
+	data, err := d.GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, metaLabelsURI, libvirt.DOMAIN_AFFECT_CONFIG)
+	if err != nil {
+		if lverr, ok := err.(libvirt.Error); ok && lverr.Code == libvirt.ERR_NO_DOMAIN_METADATA {
+			return labels, nil
+		}
+
+		fail.Printf("%sfailed to get domain labels metadata: %s\n", id, err.Error())
+		return nil, err
+	}
+
+	var meta labelsMetadata
+
+	err = xml.Unmarshal([]byte(data), &meta)
+	if err != nil {
+		fail.Printf("%sfailed to unmarshal labels metadata XML: %s\n", id, err.Error())
+		return nil, err
+	}
+
+	for _, l := range meta.Labels {
+		labels[l.Key] = l.Value
+	}
+
+	info.Printf("%sacquired domain labels\n", id)
+	return labels, nil
+}
+
+// replaces all domain labels, empty map removes labels metadata
+func setDomainLabels(ctx context.Context, d *libvirt.Domain, labels map[string]string) error {
+	id := getReqIDFromContext(ctx)
+
+	if len(labels) == 0 {
+		err := d.SetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, "", metaLabelsKey, metaLabelsURI, libvirt.DOMAIN_AFFECT_CONFIG)
+		if err != nil {
+			fail.Printf("%sfailed to remove labels metadata for domain: %s\n", id, err.Error())
+			return err
+		}
+
+		info.Printf("%sremoved domain labels\n", id)
+		return nil
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var meta labelsMetadata
+	for _, k := range keys {
+		meta.Labels = append(meta.Labels, labelMetadata{Key: k, Value: labels[k]})
+	}
+
+	data, err := xml.Marshal(meta)
+	if err != nil {
+		fail.Printf("%sfailed to marshal labels metadata for domain: %s\n", id, err.Error())
+		return err
+	}
+
+	err = d.SetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, string(data), metaLabelsKey, metaLabelsURI, libvirt.DOMAIN_AFFECT_CONFIG)
+	if err != nil {
+		fail.Printf("%sfailed to set labels metadata for domain: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sset domain labels\n", id)
+	return nil
+}
+
+func splitSelector(selector string) ([]string, error) {
+	parts := make([]string, 0)
+
+	var (
+		depth int
+		start int
+	)
+
+	for i, r := range selector {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses in label selector: %s", selector)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in label selector: %s", selector)
+	}
+
+	return append(parts, selector[start:]), nil
+}
+
+func parseSelectorValues(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("set of values must be in parentheses: %s", s)
+	}
+
+	values := make([]string, 0)
+	for _, v := range strings.Split(s[1:len(s)-1], ",") {
+		v = strings.TrimSpace(v)
+
+		err := isLabelValueValid(v)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// parseLabelSelector parses Kubernetes style label selector (key=value, key==value, key!=value, key in (a,b), key notin (a,b), key, !key),
+// requirements are separated by comma and joined by logical AND
+func parseLabelSelector(selector string) (labelSelector, error) {
+	sel := make(labelSelector, 0)
+
+	if len(strings.TrimSpace(selector)) == 0 {
+		return sel, nil
+	}
+
+	parts, err := splitSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			return nil, fmt.Errorf("empty requirement in label selector: %s", selector)
+		}
+
+		var req labelRequirement
+
+		switch {
+		case strings.HasPrefix(part, "!"):
+			req = labelRequirement{key: strings.TrimSpace(part[1:]), op: selectorOpDoesNotExist}
+
+		case strings.Contains(part, "!="):
+			kv := strings.SplitN(part, "!=", 2)
+			req = labelRequirement{key: strings.TrimSpace(kv[0]), op: selectorOpNotEquals, values: []string{strings.TrimSpace(kv[1])}}
+
+		case strings.Contains(part, "=="):
+			kv := strings.SplitN(part, "==", 2)
+			req = labelRequirement{key: strings.TrimSpace(kv[0]), op: selectorOpEquals, values: []string{strings.TrimSpace(kv[1])}}
+
+		case strings.Contains(part, "="):
+			kv := strings.SplitN(part, "=", 2)
+			req = labelRequirement{key: strings.TrimSpace(kv[0]), op: selectorOpEquals, values: []string{strings.TrimSpace(kv[1])}}
+
+		case strings.Contains(part, "("):
+			fields := strings.Fields(part[:strings.Index(part, "(")])
+			if len(fields) != 2 || (fields[1] != selectorOpIn && fields[1] != selectorOpNotIn) {
+				return nil, fmt.Errorf("not valid requirement in label selector: %s", part)
+			}
+
+			values, err := parseSelectorValues(part[strings.Index(part, "("):])
+			if err != nil {
+				return nil, err
+			}
+
+			req = labelRequirement{key: fields[0], op: fields[1], values: values}
+
+		default:
+			req = labelRequirement{key: part, op: selectorOpExists}
+		}
+
+		err = isLabelKeyValid(req.key)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range req.values {
+			err = isLabelValueValid(v)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		sel = append(sel, req)
+	}
+
+	return sel, nil
+}
+
+func (r labelRequirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.key]
+
+	switch r.op {
+	case selectorOpExists:
+		return ok
+	case selectorOpDoesNotExist:
+		return !ok
+	case selectorOpEquals:
+		return ok && value == r.values[0]
+	case selectorOpNotEquals:
+		return !ok || value != r.values[0]
+	case selectorOpIn:
+		return ok && isStringInSlice(value, r.values)
+	case selectorOpNotIn:
+		return !ok || !isStringInSlice(value, r.values)
+	}
+
+	return false
+}
+
+func (s labelSelector) matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s labelSelector) isEmpty() bool {
+	return len(s) == 0
+}
+
+// lists domains matching label selector, caller must free returned domains
+func listDomainsBySelector(ctx context.Context, c *libvirt.Connect, selector string) ([]libvirt.Domain, error) {
+	id := getReqIDFromContext(ctx)
+
+	sel, err := parseLabelSelector(selector)
+	if err != nil {
+		fail.Printf("%sfailed to parse label selector: %s\n", id, err.Error())
+		return nil, err
+	}
+
+	domains, err := listAllDomainsWithFlags(ctx, c, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if sel.isEmpty() {
+		return domains, nil
+	}
+
+	matched := make([]libvirt.Domain, 0, len(domains))
+
+	for i := range domains {
+		labels, err := getDomainLabels(ctx, &domains[i])
+		if err == nil && sel.matches(labels) {
+			matched = append(matched, domains[i])
+			continue
+		}
+
+		freeDomain(ctx, &domains[i])
+
+		if err != nil {
+			freeDomains(ctx, domains[i+1:])
+			freeDomains(ctx, matched)
+			return nil, err
+		}
+	}
+
+	info.Printf("%sfound %d domain(s) matching label selector %s\n", id, len(matched), selector)
+	return matched, nil
+}
+
+func validateLabels(labels map[string]string) error {
+	if len(labels) == 0 {
+		return errors.New("labels can not be empty")
+	}
+
+	for k, v := range labels {
+		err := isLabelKeyValid(k)
+		if err != nil {
+			return err
+		}
+
+		err = isLabelValueValid(v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     labelSelector
+		wantErr  bool
+	}{
+		{selector: "", want: labelSelector{}},
+		{selector: "  ", want: labelSelector{}},
+		{selector: "env=prod", want: labelSelector{{key: "env", op: selectorOpEquals, values: []string{"prod"}}}},
+		{selector: "env == prod", want: labelSelector{{key: "env", op: selectorOpEquals, values: []string{"prod"}}}},
+		{selector: "env!=prod", want: labelSelector{{key: "env", op: selectorOpNotEquals, values: []string{"prod"}}}},
+		{selector: "example.com/team", want: labelSelector{{key: "example.com/team", op: selectorOpExists}}},
+		{selector: "!legacy", want: labelSelector{{key: "legacy", op: selectorOpDoesNotExist}}},
+		{
+			selector: "env=prod, tier in (web, db), zone notin (a), !legacy",
+			want: labelSelector{
+				{key: "env", op: selectorOpEquals, values: []string{"prod"}},
+				{key: "tier", op: selectorOpIn, values: []string{"web", "db"}},
+				{key: "zone", op: selectorOpNotIn, values: []string{"a"}},
+				{key: "legacy", op: selectorOpDoesNotExist},
+			},
+		},
+		{selector: "env=prod,", wantErr: true},
+		{selector: "env=prod,,tier=web", wantErr: true},
+		{selector: "tier within (web)", wantErr: true},
+		{selector: "tier in (web", wantErr: true},
+		{selector: "-env=prod", wantErr: true},
+		{selector: "env=not valid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseLabelSelector(tt.selector)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseLabelSelector(%q) = %+v, expected error", tt.selector, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseLabelSelector(%q) error: %v", tt.selector, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLabelSelector(%q) = %+v, want %+v", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestLabelSelectorMatches(t *testing.T) {
+	labels := map[string]string{"env": "prod", "tier": "web"}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{selector: "", want: true},
+		{selector: "env=prod", want: true},
+		{selector: "env=dev", want: false},
+		{selector: "env!=dev", want: true},
+		{selector: "zone!=a", want: true},
+		{selector: "tier in (web,db)", want: true},
+		{selector: "tier notin (web,db)", want: false},
+		{selector: "zone notin (a)", want: true},
+		{selector: "zone in (a)", want: false},
+		{selector: "tier", want: true},
+		{selector: "!tier", want: false},
+		{selector: "env=prod,!zone", want: true},
+		{selector: "env=prod,zone", want: false},
+	}
+
+	for _, tt := range tests {
+		sel, err := parseLabelSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("parseLabelSelector(%q) error: %v", tt.selector, err)
+		}
+
+		if got := sel.matches(labels); got != tt.want {
+			t.Errorf("selector %q matches %v: %t, want %t", tt.selector, labels, got, tt.want)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/user"
 	"runtime"
+	"time"
 
 	"github.com/semrush/zenrpc"
 )
@@ -28,24 +29,54 @@ const (
 type JRPCService struct{ zenrpc.Service }
 
 var (
-	info *log.Logger
-	fail *log.Logger
+	// loggers are replaced in main when events are written to files
+	info = log.New(os.Stdout, "INF: ", log.LstdFlags|log.Lshortfile)
+	fail = log.New(os.Stdout, "ERR: ", log.LstdFlags|log.Lshortfile)
 
 	buildDate = undefined
 	gitBranch = undefined
 	gitState  = undefined
 	gitCommit = undefined
 
-	ip     *string
-	port   *int
-	socket *string
+	logToFile    *bool
+	ip           *string
+	port         *int
+	socket       *string
+	templatesDir *string
+
+	idempotencyStorePath *string
+	idempotencyWindow    *time.Duration
+
+	policyPath          *string
+	blockIOProfilesPath *string
+	catalogDir          *string
+	importDir           *string
+	volumeTransfer      *bool
 )
 
+// flags are defined in init and parsed in main, so tests of package can be run with test flags
 func init() {
 	if runtime.NumCPU() > 1 {
 		runtime.GOMAXPROCS(2)
 	}
 
+	logToFileDesc := fmt.Sprintf("write events to main log \"/var/log/%s-main.log\" and errors log to \"/var/log/%s-errors.log\"", app, app)
+	logToFile = flag.Bool("log-to-files", false, logToFileDesc)
+
+	ip = flag.String("ip", "127.0.0.1", "IP that JRPC server will bind to")
+	port = flag.Int("port", 8888, "port number that JRPC server will bind to")
+	socket = flag.String("unix-socket", "", "path to Unix domain socket insted of IP that JRPC server will bind to")
+	templatesDir = flag.String("templates-dir", fmt.Sprintf("/etc/%s/templates", app), "path to directory with domain XML templates (<name>.xml)")
+	idempotencyStorePath = flag.String("idempotency-store", fmt.Sprintf("/var/lib/%s/idempotency.json", app), "path to file where results of requests with Idempotency-Key header are kept")
+	policyPath = flag.String("policy", fmt.Sprintf("/etc/%s/policy.json", app), "path to JSON file with admission policy, defaults are used for omitted fields")
+	blockIOProfilesPath = flag.String("blockio-profiles", fmt.Sprintf("/etc/%s/blockio-profiles.json", app), "path to JSON file with named block IO profiles, defaults are used for omitted profiles")
+	catalogDir = flag.String("catalog-dir", fmt.Sprintf("/var/lib/%s/catalog", app), "path to directory with template catalogs of storage pools (<pool>.json)")
+	importDir = flag.String("import-dir", fmt.Sprintf("/var/lib/%s/import", app), "path to directory with local disk images allowed as ImportDisk source, empty value allows only pool volumes")
+	volumeTransfer = flag.Bool("volume-transfer", false, "serve volume upload and download at /volumes/, there is no authentication, same as for /jrpc")
+	idempotencyWindow = flag.Duration("idempotency-window", 24*time.Hour, "how long results of requests with Idempotency-Key header are kept, 0 disables idempotency keys")
+}
+
+func main() {
 	userDef, err := user.Current()
 	if err != nil {
 		log.Fatalf("Failed to get current user info: %s", err.Error())
@@ -55,16 +86,9 @@ func init() {
 		log.Fatalf("@_@ Program should be run with root privileges!")
 	}
 
-	logToFileDesc := fmt.Sprintf("write events to main log \"/var/log/%s-main.log\" and errors log to \"/var/log/%s-errors.log\"", app, app)
-	logToFilePtr := flag.Bool("log-to-files", false, logToFileDesc)
-
-	ip = flag.String("ip", "127.0.0.1", "IP that JRPC server will bind to")
-	port = flag.Int("port", 8888, "port number that JRPC server will bind to")
-	socket = flag.String("unix-socket", "", "path to Unix domain socket insted of IP that JRPC server will bind to")
-
 	flag.Parse()
 
-	if *logToFilePtr {
+	if *logToFile {
 		mainLog, err := os.OpenFile(fmt.Sprintf("/var/log/%s-main.log", app), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
 		if err != nil {
 			log.Fatalf("Failed to open log file: %s", err.Error())
@@ -77,15 +101,24 @@ func init() {
 
 		info = log.New(io.MultiWriter(os.Stdout, mainLog), "INF: ", log.LstdFlags|log.Lshortfile)
 		fail = log.New(io.MultiWriter(os.Stdout, mainLog, errorsLog), "ERR: ", log.LstdFlags|log.Lshortfile)
-	} else {
-		info = log.New(os.Stdout, "INF: ", log.LstdFlags|log.Lshortfile)
-		fail = log.New(os.Stdout, "ERR: ", log.LstdFlags|log.Lshortfile)
 	}
-}
 
-func main() {
 	info.Printf("Build Date: %s, Git Branch: %s, Git State: %s, Git Commit: %s", buildDate, gitBranch, gitState, gitCommit)
 
+	p, err := loadAdmissionPolicy(*policyPath)
+	if err != nil {
+		fail.Fatalf("Failed to load admission policy: %s", err.Error())
+	}
+
+	policy = p
+
+	profiles, err := loadBlockIOProfiles(*blockIOProfilesPath)
+	if err != nil {
+		fail.Fatalf("Failed to load block IO profiles: %s", err.Error())
+	}
+
+	blockIOProfiles = profiles
+
 	jrpc := zenrpc.NewServer(zenrpc.Options{
 		BatchMaxLen:            1,
 		TargetURL:              "jrpc",
@@ -98,9 +131,22 @@ func main() {
 	jrpc.Register("", JRPCService{}) // public
 	jrpc.Use(logger())
 
+	if *idempotencyWindow > 0 {
+		store, err := newIdempotencyStore(*idempotencyStorePath, *idempotencyWindow)
+		if err != nil {
+			fail.Fatalf("Failed to open idempotency store: %s", err.Error())
+		}
+
+		idemStore = store
+		jrpc.Use(idempotencyChecker())
+	}
+
 	if len(*socket) == 0 {
 		mux := http.NewServeMux()
 		mux.Handle("/jrpc", jrpc)
+		if *volumeTransfer {
+			mux.Handle(transferURLPrefix, loggingHandler(volumeTransferHandler()))
+		}
 		mux.Handle("/", loggingHandler(http.FileServer(http.Dir("ui"))))
 
 		info.Printf("Starting JRPC server on %s:%d", *ip, *port)
@@ -111,6 +157,9 @@ func main() {
 		}
 	} else {
 		http.Handle("/jrpc", jrpc)
+		if *volumeTransfer {
+			http.Handle(transferURLPrefix, loggingHandler(volumeTransferHandler()))
+		}
 		http.Handle("/", loggingHandler(http.FileServer(http.Dir("ui"))))
 
 		info.Printf("Starting JRPC server on %s", *socket)
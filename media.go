@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// CD-ROM drive for operator media, cloud-init seed drive is never used for it
+func isMediaCDROM(disk libvirtxml.DomainDisk) bool {
+	if disk.Device != "cdrom" {
+		return false
+	}
+
+	return disk.Source == nil || disk.Source.File == nil || !strings.HasSuffix(filepath.Base(disk.Source.File.File), cloudInitSeedSuffix)
+}
+
+func findMediaCDROM(domCfg *libvirtxml.Domain) *libvirtxml.DomainDisk {
+	if domCfg.Devices == nil {
+		return nil
+	}
+
+	for i := range domCfg.Devices.Disks {
+		if isMediaCDROM(domCfg.Devices.Disks[i]) {
+			return &domCfg.Devices.Disks[i]
+		}
+	}
+
+	return nil
+}
+
+// changes source of media CD-ROM, nil source ejects media, drive is added to persistent config of inactive domain when missing
+func changeDomainMedia(ctx context.Context, d *libvirt.Domain, source *libvirtxml.DomainDiskSource) error {
+	id := getReqIDFromContext(ctx)
+
+	domCfg, err := getDomainInactiveConfig(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	active := isDomainActive(ctx, d)
+
+	cdrom := findMediaCDROM(domCfg)
+	if cdrom == nil {
+		if source == nil {
+			fail.Printf("%sdomain has no CD-ROM drive\n", id)
+			return errors.New("domain has no CD-ROM drive")
+		}
+
+		// IDE CD-ROM can not be plugged into running domain
+		if active {
+			fail.Printf("%sdomain has no CD-ROM drive, it can be added only to shut off domain\n", id)
+			return errors.New("domain has no CD-ROM drive, it can be added only to shut off domain")
+		}
+
+		target, err := getDomainFreeDiskTarget(ctx, d, "ide")
+		if err != nil {
+			return err
+		}
+
+		drive := libvirtxml.DomainDisk{
+			Device: "cdrom",
+			Driver: &libvirtxml.DomainDiskDriver{
+				Name: "qemu",
+				Type: "raw",
+			},
+			Source: source,
+			Target: &libvirtxml.DomainDiskTarget{
+				Dev: target,
+				Bus: "ide",
+			},
+			ReadOnly: &libvirtxml.DomainDiskReadOnly{},
+		}
+
+		xml, err := drive.Marshal()
+		if err != nil {
+			fail.Printf("%sfailed to marshal disk XML: %s\n", id, err.Error())
+			return err
+		}
+
+		err = d.AttachDeviceFlags(xml, libvirt.DOMAIN_DEVICE_MODIFY_CONFIG)
+		if err != nil {
+			fail.Printf("%sfailed to add CD-ROM drive %s: %s\n", id, target, err.Error())
+			return err
+		}
+
+		info.Printf("%sadded CD-ROM drive %s with media\n", id, target)
+		return nil
+	}
+
+	drive := *cdrom
+	drive.Source = source
+
+	// drive type must follow source type, empty drive is file type
+	if source != nil && source.Block != nil {
+		drive.Driver = &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "raw"}
+	}
+
+	xml, err := drive.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal disk XML: %s\n", id, err.Error())
+		return err
+	}
+
+	flags := getDomainDeviceModifyFlags(ctx, d)
+	if active {
+		// guest may keep tray locked
+		flags |= libvirt.DOMAIN_DEVICE_MODIFY_FORCE
+	}
+
+	err = d.UpdateDeviceFlags(xml, flags)
+	if err != nil {
+		fail.Printf("%sfailed to change media of CD-ROM drive %s: %s\n", id, drive.Target.Dev, err.Error())
+		return err
+	}
+
+	info.Printf("%schanged media of CD-ROM drive %s\n", id, drive.Target.Dev)
+	return nil
+}
+
+func insertDomainMedia(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain, pool, iso string) error {
+	disk, err := getPoolDomainTemplateDisk(ctx, c, pool, iso, "")
+	if err != nil {
+		return err
+	}
+
+	_, source := getDomainDiskSource(disk)
+
+	return changeDomainMedia(ctx, d, source)
+}
+
+func ejectDomainMedia(ctx context.Context, d *libvirt.Domain) error {
+	return changeDomainMedia(ctx, d, nil)
+}
+
+func validateBootOrder(order []string) error {
+	problems := make([]string, 0)
+
+	if len(order) == 0 {
+		problems = append(problems, "boot order can not be empty")
+	}
+
+	seen := make(map[string]bool)
+	for _, dev := range order {
+		if !isStringInSlice(dev, specBootDevices) {
+			problems = append(problems, fmt.Sprintf("unknown boot device: %s", dev))
+		}
+
+		if seen[dev] {
+			problems = append(problems, fmt.Sprintf("duplicate boot device: %s", dev))
+		}
+		seen[dev] = true
+	}
+
+	if len(problems) != 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// sets boot order of persistent config, takes effect on next domain start
+func setDomainBootOrder(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain, order []string) error {
+	id := getReqIDFromContext(ctx)
+
+	err := validateBootOrder(order)
+	if err != nil {
+		fail.Printf("%sfailed to validate boot order: %s\n", id, err.Error())
+		return err
+	}
+
+	domCfg, err := getDomainInactiveConfig(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	if domCfg.OS == nil {
+		domCfg.OS = &libvirtxml.DomainOS{}
+	}
+
+	domCfg.OS.BootDevices = make([]libvirtxml.DomainBootDevice, 0, len(order))
+	for _, dev := range order {
+		domCfg.OS.BootDevices = append(domCfg.OS.BootDevices, libvirtxml.DomainBootDevice{Dev: dev})
+	}
+
+	// per-device boot order can not be combined with os boot devices
+	if domCfg.Devices != nil {
+		for i := range domCfg.Devices.Disks {
+			domCfg.Devices.Disks[i].Boot = nil
+		}
+
+		for i := range domCfg.Devices.Interfaces {
+			domCfg.Devices.Interfaces[i].Boot = nil
+		}
+	}
+
+	xml, err := domCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal domain XML: %s\n", id, err.Error())
+		return err
+	}
+
+	dom, err := defineDomain(ctx, c, xml)
+	if err != nil {
+		return err
+	}
+	defer freeDomain(ctx, dom)
+
+	info.Printf("%sset boot order to %s\n", id, strings.Join(order, ", "))
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -255,10 +256,13 @@ func getNodeMemoryStats(ctx context.Context) (nodeMemoryStats, error) {
 	return memInfo, nil
 }
 
-func isMemoryAvailable(ctx context.Context, c *libvirt.Connect, memory uint) (bool, error) {
-	id := getReqIDFromContext(ctx)
+func isMemoryAvailable(ctx context.Context, c *libvirt.Connect, memory, maxMemory uint) (bool, error) {
+	return isMemoryChangeAvailable(ctx, c, memory, maxMemory, 0)
+}
 
-	maxMemory := 2 * memory
+// released maximum memory [KiB] is already assigned to domain being changed, limits of maximum memory are checked only when it grows
+func isMemoryChangeAvailable(ctx context.Context, c *libvirt.Connect, memory, maxMemory uint, released uint64) (bool, error) {
+	id := getReqIDFromContext(ctx)
 
 	nodeMemStats, err := getNodeMemoryStats(ctx)
 	if err != nil {
@@ -275,11 +279,94 @@ func isMemoryAvailable(ctx context.Context, c *libvirt.Connect, memory uint) (bo
 		return false, fmt.Errorf("memory can not be lesser that 256 MB")
 	}
 
-	if uint64(maxMemory) > nodeMemStats.Available {
-		fail.Printf("%samount of maximum memory for domain: %d KiB is greater than available memory on hypervisor: %d KiB\n", id, maxMemory, nodeMemStats.Available)
-		return false, fmt.Errorf("amount of maximum memory for domain: %d KiB is greater than available memory on hypervisor: %d KiB", maxMemory, nodeMemStats.Free)
+	if uint64(maxMemory) <= released {
+		info.Printf("%smaximum memory: %d KiB is not increased\n", id, maxMemory)
+		return true, nil
+	}
+
+	if policy.MaxMemoryPerVM != 0 && maxMemory > policy.MaxMemoryPerVM {
+		fail.Printf("%samount of maximum memory for domain: %d KiB is greater than allowed per domain: %d KiB\n", id, maxMemory, policy.MaxMemoryPerVM)
+		return false, fmt.Errorf("amount of maximum memory for domain: %d KiB is greater than allowed per domain: %d KiB", maxMemory, policy.MaxMemoryPerVM)
+	}
+
+	assigned, err := getAssignedNodeMaxMemory(ctx, c)
+	if err != nil {
+		return false, err
+	}
+
+	var admissible uint64
+	if nodeMemStats.Total > policy.ReservedHostMemory {
+		admissible = nodeMemStats.Total - policy.ReservedHostMemory
 	}
 
-	info.Printf("%sMemory: %d available\n", id, nodeMemStats.Available)
+	limit := uint64(float64(admissible) * policy.MemoryOvercommitRatio)
+	if assigned+uint64(maxMemory)-released > limit {
+		fail.Printf("%smaximum memory for domain: %d KiB with already assigned: %d KiB is greater than overcommit limit: %d KiB\n", id, maxMemory, assigned, limit)
+		return false, fmt.Errorf("maximum memory for domain: %d KiB with already assigned: %d KiB is greater than overcommit limit: %d KiB", maxMemory, assigned, limit)
+	}
+
+	info.Printf("%sMemory: %d KiB available\n", id, limit-assigned)
 	return true, nil
 }
+
+// sums maximum memory of all defined domains, active or not, in KiB
+func getAssignedNodeMaxMemory(ctx context.Context, c *libvirt.Connect) (uint64, error) {
+	var sum uint64
+
+	id := getReqIDFromContext(ctx)
+
+	domains, err := listAllDomainsWithFlags(ctx, c, libvirt.ConnectListAllDomainsFlags(0))
+	if err != nil {
+		return 0, err
+	}
+	defer freeDomains(ctx, domains)
+
+	for i := range domains {
+		mem, err := domains[i].GetMaxMemory()
+		if err != nil {
+			continue
+		}
+		sum += mem
+	}
+
+	info.Printf("%sacquired globally assigned maximum memory: %d KiB\n", id, sum)
+	return sum, nil
+}
+
+// https://libvirt.org/formatdomain.html#memory-allocation
+func memoryToKiB(ctx context.Context, value uint, unit string) (uint, error) {
+	id := getReqIDFromContext(ctx)
+
+	var multiplier, divider uint64 = 1, 1
+
+	switch unit {
+	case "b", "bytes":
+		divider = 1024
+	case "KB":
+		multiplier, divider = 1000, 1024
+	case "", "k", "KiB":
+		multiplier = 1
+	case "MB":
+		multiplier, divider = 1000*1000, 1024
+	case "M", "MiB":
+		multiplier = 1024
+	case "GB":
+		multiplier, divider = 1000*1000*1000, 1024
+	case "G", "GiB":
+		multiplier = 1024 * 1024
+	case "TB":
+		multiplier, divider = 1000*1000*1000*1000, 1024
+	case "T", "TiB":
+		multiplier = 1024 * 1024 * 1024
+	default:
+		fail.Printf("%sunknown memory unit: %s\n", id, unit)
+		return 0, fmt.Errorf("unknown memory unit: %s", unit)
+	}
+
+	if uint64(value) > math.MaxUint64/multiplier {
+		fail.Printf("%smemory value %d %s is too large\n", id, value, unit)
+		return 0, fmt.Errorf("memory value %d %s is too large", value, unit)
+	}
+
+	return uint(uint64(value) * multiplier / divider), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestMemoryToKiB(t *testing.T) {
+	tests := []struct {
+		value   uint
+		unit    string
+		want    uint
+		wantErr bool
+	}{
+		{value: 1048576, unit: "", want: 1048576},
+		{value: 1048576, unit: "k", want: 1048576},
+		{value: 1048576, unit: "KiB", want: 1048576},
+		{value: 4096, unit: "b", want: 4},
+		{value: 4096, unit: "bytes", want: 4},
+		{value: 1024, unit: "KB", want: 1000},
+		{value: 1024, unit: "M", want: 1048576},
+		{value: 1024, unit: "MiB", want: 1048576},
+		{value: 1024, unit: "MB", want: 1000000},
+		{value: 2, unit: "G", want: 2097152},
+		{value: 2, unit: "GiB", want: 2097152},
+		{value: 2, unit: "GB", want: 1953125},
+		{value: 1, unit: "T", want: 1073741824},
+		{value: 1, unit: "TiB", want: 1073741824},
+		{value: 1, unit: "TB", want: 976562500},
+		{value: 1, unit: "PiB", wantErr: true},
+		{value: 1, unit: "kib", wantErr: true},
+		{value: math.MaxUint64 / 1024, unit: "M", want: math.MaxUint64 / 1024 * 1024},
+		{value: math.MaxUint64/1024 + 1, unit: "M", wantErr: true},
+		{value: math.MaxUint64, unit: "b", want: math.MaxUint64 / 1024},
+		{value: math.MaxUint64, unit: "TB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := memoryToKiB(context.Background(), tt.value, tt.unit)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("memoryToKiB(%d, %q) = %d, expected error", tt.value, tt.unit, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("memoryToKiB(%d, %q) error: %v", tt.value, tt.unit, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("memoryToKiB(%d, %q) = %d, want %d", tt.value, tt.unit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+	"github.com/pierrec/lz4"
+)
+
+/* global variable declaration, if any... */
+const (
+	orphanKindDisk   = "disk"
+	orphanKindBackup = "backup"
+	orphanKindSeed   = "cloud-init seed"
+	orphanKindOther  = "volume"
+)
+
+// matches suffix of backup file name made by createBackup: <disk path>_<timestamp>_backup.lz4
+var backupSuffixRegexp = regexp.MustCompile(`_[0-9]{14}_backup` + regexp.QuoteMeta(lz4.Extension) + `$`)
+
+// returns paths referenced by live and persistent configurations of all defined domains
+func getDomainsReferencedPaths(ctx context.Context, c *libvirt.Connect) (map[string]bool, error) {
+	id := getReqIDFromContext(ctx)
+
+	users, err := getDomainsDiskPaths(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool, len(users))
+
+	for path := range users {
+		paths[path] = true
+	}
+
+	info.Printf("%sacquired %d path(s) referenced by domains\n", id, len(paths))
+	return paths, nil
+}
+
+func getOrphanKind(name string) string {
+	switch {
+	case backupSuffixRegexp.MatchString(name):
+		return orphanKindBackup
+	case strings.HasSuffix(name, cloudInitSeedSuffix):
+		return orphanKindSeed
+	case strings.HasSuffix(name, ".qcow2"):
+		return orphanKindDisk
+	}
+
+	return orphanKindOther
+}
+
+// returns seconds since last modification of volume, ok is false when pool does not report timestamps
+func getVolumeAge(ctx context.Context, v *libvirt.StorageVol) (uint64, bool) {
+	xml, err := v.GetXMLDesc(0)
+	if err != nil {
+		return 0, false
+	}
+
+	volCfg := &libvirtxml.StorageVolume{}
+	err = volCfg.Unmarshal(xml)
+	if err != nil || volCfg.Target == nil || volCfg.Target.Timestamps == nil {
+		return 0, false
+	}
+
+	sec, err := strconv.ParseInt(strings.SplitN(volCfg.Target.Timestamps.Mtime, ".", 2)[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	age := time.Now().Unix() - sec
+	if age < 0 {
+		age = 0
+	}
+
+	return uint64(age), true
+}
+
+// ISO library volumes are inserted into CD-ROM on demand, cloud-init seed is generated per domain
+func isLibraryISO(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".iso") && !strings.HasSuffix(name, cloudInitSeedSuffix)
+}
+
+// lists volumes of all active pools which are not referenced by any domain, linked clone, template catalog or backup catalog,
+// ISO library, targets of running imports and volumes of unfinished chunked uploads are never listed
+func findOrphanVolumes(ctx context.Context, c *libvirt.Connect) ([]OrphanVolume, error) {
+	id := getReqIDFromContext(ctx)
+
+	err := refreshAllStorgePools(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced, err := getDomainsReferencedPaths(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogMutex.Lock()
+	backups, err := loadBackupCatalog(ctx)
+	catalogMutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// volumes which are written right now, <pool>/<volume>
+	busy := getRunningImportTargets()
+
+	pendingUploads.Range(func(k, _ interface{}) bool {
+		busy[k.(string)] = true
+		return true
+	})
+
+	pools, err := listStorgePools(ctx, c, libvirt.CONNECT_LIST_STORAGE_POOLS_ACTIVE)
+	if err != nil {
+		return nil, err
+	}
+	defer freePools(ctx, pools)
+
+	orphans := make([]OrphanVolume, 0)
+
+	for i := range pools {
+		pool, err := getPoolName(ctx, &pools[i])
+		if err != nil {
+			return nil, err
+		}
+
+		vols, err := listPoolVolumesInfo(ctx, c, pool)
+		if err != nil {
+			return nil, err
+		}
+
+		templates, err := listImageTemplates(ctx, c, pool)
+		if err != nil {
+			return nil, err
+		}
+
+		kept := make(map[string]bool)
+
+		for _, t := range templates {
+			kept[t.Name] = true
+		}
+
+		backing := make(map[string]bool)
+
+		for _, v := range vols {
+			if len(v.BackingStore) != 0 {
+				backing[v.BackingStore] = true
+			}
+		}
+
+		for _, v := range vols {
+			if _, ok := backups[v.Path]; ok || referenced[v.Path] || backing[v.Path] || kept[v.Name] || busy[pool+"/"+v.Name] || isLibraryISO(v.Name) {
+				continue
+			}
+
+			kind := getOrphanKind(v.Name)
+
+			// backup made before backup catalog is kept while disk it was made from is in use
+			if kind == orphanKindBackup && referenced[backupSuffixRegexp.ReplaceAllString(v.Path, "")] {
+				continue
+			}
+
+			o := OrphanVolume{
+				Pool:       pool,
+				Name:       v.Name,
+				Path:       v.Path,
+				Kind:       kind,
+				Allocation: v.Allocation,
+			}
+
+			vol, err := lookupPoolVolume(ctx, c, pool, v.Name)
+			if err == nil {
+				o.Age, o.AgeKnown = getVolumeAge(ctx, vol)
+				freeVolume(ctx, vol)
+			}
+
+			orphans = append(orphans, o)
+		}
+	}
+
+	info.Printf("%sfound %d orphaned volume(s)\n", id, len(orphans))
+	return orphans, nil
+}
+
+// removes orphaned volumes not modified for at least minAge seconds, volumes of unknown age are removed only with removeUnknownAge
+func collectOrphanVolumes(ctx context.Context, c *libvirt.Connect, dryRun bool, minAge uint64, removeUnknownAge bool) ([]OrphanVolume, error) {
+	id := getReqIDFromContext(ctx)
+
+	orphans, err := findOrphanVolumes(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]OrphanVolume, 0, len(orphans))
+
+	for _, o := range orphans {
+		if (o.AgeKnown && o.Age < minAge) || (!o.AgeKnown && !removeUnknownAge) {
+			continue
+		}
+
+		if !dryRun {
+			// domains are re-checked by deleteUnusedPoolVolume right before removal
+			err = deleteUnusedPoolVolume(ctx, c, o.Pool, o.Name)
+			if err != nil {
+				o.Error = err.Error()
+			} else {
+				o.Removed = true
+			}
+		}
+
+		r = append(r, o)
+	}
+
+	info.Printf("%scollected %d orphaned volume(s), dry-run: %t\n", id, len(r), dryRun)
+	return r, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libvirt/libvirt-go"
+)
+
+func newPlanCheck(name, value string, ok bool, err error) planCheck {
+	check := planCheck{
+		Name:   name,
+		Passed: ok && err == nil,
+		Value:  value,
+	}
+
+	if err != nil {
+		check.Error = err.Error()
+	}
+
+	return check
+}
+
+// planCreateDomain runs every Create check and renders domain XML without changing anything
+func planCreateDomain(ctx context.Context, c *libvirt.Connect, uuid, name string, vCPU, maxVCPUs int, memory, maxMemory uint, storage, template, network, mac string, vlan uint) PlanCreateResponse {
+	id := getReqIDFromContext(ctx)
+
+	plan := PlanCreateResponse{
+		Checks: make([]planCheck, 0),
+	}
+
+	ok, err := isUUIDValid(ctx, uuid)
+	plan.Checks = append(plan.Checks, newPlanCheck("UUID", uuid, ok, err))
+
+	ok, err = isDomainNameValidAndAvailable(ctx, c, name)
+	plan.Checks = append(plan.Checks, newPlanCheck("Name", name, ok, err))
+
+	value := fmt.Sprintf("requested: %d", vCPU)
+	if nodeInfo, err := getNodeInfo(ctx, c); err == nil {
+		value = fmt.Sprintf("%s, host cores: %d", value, nodeInfo.Cpus)
+	}
+	if assigned, err := getNumOfAssignedNodeVCPUs(ctx, c); err == nil {
+		value = fmt.Sprintf("%s, assigned: %d", value, assigned)
+	}
+	ok, err = isVCPUAvailable(ctx, c, vCPU)
+	plan.Checks = append(plan.Checks, newPlanCheck("VCPU", value, ok, err))
+
+	value = fmt.Sprintf("requested: %d KiB, maximum: %d KiB", memory, maxMemory)
+	if memStats, err := getNodeMemoryStats(ctx); err == nil {
+		value = fmt.Sprintf("%s, host: %d KiB", value, memStats.Total)
+	}
+	if assigned, err := getAssignedNodeMaxMemory(ctx, c); err == nil {
+		value = fmt.Sprintf("%s, assigned: %d KiB", value, assigned)
+	}
+	ok, err = isMemoryAvailable(ctx, c, memory, maxMemory)
+	plan.Checks = append(plan.Checks, newPlanCheck("Memory", value, ok, err))
+
+	value = storage
+	if pool, err := lookupPoolByName(ctx, c, storage); err == nil {
+		if poolInfo, err := getPoolInfo(ctx, pool); err == nil {
+			value = fmt.Sprintf("%s, available: %d bytes", storage, poolInfo.Available)
+		}
+		freePool(ctx, pool)
+	}
+	ok, err = isStorageAvailable(ctx, c, storage)
+	plan.Checks = append(plan.Checks, newPlanCheck("Storage", value, ok, err))
+
+	value = template
+	if path, err := getPoolFilePath(ctx, c, storage, template); err == nil {
+		value = path
+	}
+	ok, err = isTemplateInsideStorageAvailable(ctx, c, storage, template)
+	plan.Checks = append(plan.Checks, newPlanCheck("Template", value, ok, err))
+
+	value = network
+	if free, err := getNetworkFreeVFCount(ctx, c, network); err == nil {
+		value = fmt.Sprintf("%s, free VF(s): %d", network, free)
+	}
+	ok, err = isNetworkVFAvailable(ctx, c, network)
+	if err == nil {
+		plan.VF, err = getNetworkFirstFreeVF(ctx, c, network)
+		ok = err == nil
+	}
+	plan.Checks = append(plan.Checks, newPlanCheck("NetworkVF", value, ok, err))
+
+	ok, err = isMACvalid(ctx, mac)
+	plan.Checks = append(plan.Checks, newPlanCheck("MAC", mac, ok, err))
+
+	plan.ImagePath, err = getNewDomainImageName(ctx, c, name, storage)
+	plan.Checks = append(plan.Checks, newPlanCheck("ImagePath", plan.ImagePath, true, err))
+
+	plan.XML, err = prepareXMLforNewDomain(ctx, c, uuid, name, vCPU, maxVCPUs, memory, maxMemory, storage, template, network, mac, vlan)
+	plan.Checks = append(plan.Checks, newPlanCheck("XML", defaultDomainTemplate, true, err))
+
+	plan.Ready = true
+	for _, check := range plan.Checks {
+		if !check.Passed {
+			plan.Ready = false
+		}
+	}
+
+	info.Printf("%splanned creation of domain %s, ready: %t\n", id, name, plan.Ready)
+	return plan
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+/* global variable declaration, if any... */
+var policy = defaultAdmissionPolicy()
+
+func defaultAdmissionPolicy() AdmissionPolicy {
+	return AdmissionPolicy{
+		CPUOvercommitRatio:    4,
+		MemoryOvercommitRatio: 1,
+		ReservedHostMemory:    0,
+		MinPoolHeadroom:       50 * 1024 * 1024 * 1024,
+		MaxVCPUPerVM:          16,
+		MaxMemoryPerVM:        0,
+	}
+}
+
+// loadAdmissionPolicy reads JSON policy file, omitted fields keep default values, missing file means defaults
+func loadAdmissionPolicy(path string) (AdmissionPolicy, error) {
+	p := defaultAdmissionPolicy()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return p, fmt.Errorf("failed to parse admission policy %s: %s", path, err.Error())
+	}
+
+	if p.CPUOvercommitRatio <= 0 || p.MemoryOvercommitRatio <= 0 {
+		return p, errors.New("overcommit ratios must be positive")
+	}
+
+	if p.MaxVCPUPerVM <= 0 {
+		return p, errors.New("max vCPU per VM must be positive")
+	}
+
+	return p, nil
+}
+
+// maximum memory of new domain: twice the memory, limited by policy
+func getPolicyMaxMemory(memory uint) uint {
+	maxMemory := 2 * memory
+
+	if policy.MaxMemoryPerVM != 0 && maxMemory > policy.MaxMemoryPerVM {
+		maxMemory = policy.MaxMemoryPerVM
+	}
+
+	if maxMemory < memory {
+		maxMemory = memory
+	}
+
+	return maxMemory
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+/* global variable declaration, if any... */
+const (
+	poolTypeDir     = "dir"
+	poolTypeFS      = "fs"
+	poolTypeNetFS   = "netfs"
+	poolTypeLogical = "logical"
+	poolTypeDisk    = "disk"
+	poolTypeISCSI   = "iscsi"
+	poolTypeRBD     = "rbd"
+)
+
+// pool types which can be defined by DefinePool
+var poolSpecTypes = []string{poolTypeDir, poolTypeLogical, poolTypeNetFS, poolTypeRBD, poolTypeISCSI}
+
+const (
+	diskTypeFile   = "file"
+	diskTypeBlock  = "block"
+	diskTypeVolume = "volume"
+)
+
+// volumes are plain files inside mounted directory
+func isPoolFileBased(poolType string) bool {
+	return poolType == poolTypeDir || poolType == poolTypeFS || poolType == poolTypeNetFS
+}
+
+// volume path can be derived from pool path and volume name before volume is created
+func isPoolVolumePathPredictable(poolType string) bool {
+	return isPoolFileBased(poolType) || poolType == poolTypeLogical || poolType == poolTypeRBD
+}
+
+// returns domain disk type for volumes of storage pool: file, block device or libvirt volume reference for network pools
+func getPoolDiskType(poolType string) string {
+	switch {
+	case isPoolFileBased(poolType):
+		return diskTypeFile
+	case poolType == poolTypeRBD:
+		return diskTypeVolume
+	default:
+		return diskTypeBlock
+	}
+}
+
+func getPoolType(ctx context.Context, c *libvirt.Connect, storage string) (string, error) {
+	pool, err := lookupPoolByName(ctx, c, storage)
+	if err != nil {
+		return "", err
+	}
+	defer freePool(ctx, pool)
+
+	poolCfg, err := getPoolConfig(ctx, pool)
+	if err != nil {
+		return "", err
+	}
+
+	return poolCfg.Type, nil
+}
+
+// describes volume as domain template disk, format is acquired from volume or, when volume does not exist yet, from template volume it is cloned from
+func getPoolDomainTemplateDisk(ctx context.Context, c *libvirt.Connect, storage, volume, template string) (DomainTemplateDisk, error) {
+	pool, err := lookupPoolByName(ctx, c, storage)
+	if err != nil {
+		return DomainTemplateDisk{}, err
+	}
+	defer freePool(ctx, pool)
+
+	poolCfg, err := getPoolConfig(ctx, pool)
+	if err != nil {
+		return DomainTemplateDisk{}, err
+	}
+
+	path, err := getPoolFilePath(ctx, c, storage, volume)
+	if err != nil {
+		return DomainTemplateDisk{}, err
+	}
+
+	disk := DomainTemplateDisk{
+		Type:   getPoolDiskType(poolCfg.Type),
+		Path:   path,
+		Pool:   storage,
+		Volume: volume,
+		Format: volumeFormatRaw,
+	}
+
+	if !isPoolFileBased(poolCfg.Type) {
+		return disk, nil
+	}
+
+	disk.Format = volumeFormatQcow2
+
+	for _, name := range []string{volume, template} {
+		if len(name) == 0 {
+			continue
+		}
+
+		vol, err := pool.LookupStorageVolByName(name)
+		if err != nil {
+			continue
+		}
+
+		volInfo, err := getVolumeInfoResponse(ctx, vol, nil)
+		freeVolume(ctx, vol)
+
+		if err == nil && len(volInfo.Format) != 0 {
+			disk.Format = volInfo.Format
+		}
+
+		break
+	}
+
+	return disk, nil
+}
+
+func getDomainDiskSource(disk DomainTemplateDisk) (string, *libvirtxml.DomainDiskSource) {
+	switch disk.Type {
+	case diskTypeBlock:
+		return diskTypeBlock, &libvirtxml.DomainDiskSource{
+			Block: &libvirtxml.DomainDiskSourceBlock{
+				Dev: disk.Path,
+			},
+		}
+	case diskTypeVolume:
+		return diskTypeVolume, &libvirtxml.DomainDiskSource{
+			Volume: &libvirtxml.DomainDiskSourceVolume{
+				Pool:   disk.Pool,
+				Volume: disk.Volume,
+			},
+		}
+	default:
+		return diskTypeFile, &libvirtxml.DomainDiskSource{
+			File: &libvirtxml.DomainDiskSourceFile{
+				File: disk.Path,
+			},
+		}
+	}
+}
+
+func getPoolStateName(state libvirt.StoragePoolState) string {
+	switch state {
+	case libvirt.STORAGE_POOL_INACTIVE:
+		return "STORAGE_POOL_INACTIVE"
+	case libvirt.STORAGE_POOL_BUILDING:
+		return "STORAGE_POOL_BUILDING"
+	case libvirt.STORAGE_POOL_RUNNING:
+		return "STORAGE_POOL_RUNNING"
+	case libvirt.STORAGE_POOL_DEGRADED:
+		return "STORAGE_POOL_DEGRADED"
+	case libvirt.STORAGE_POOL_INACCESSIBLE:
+		return "STORAGE_POOL_INACCESSIBLE"
+	default:
+		return "STORAGE_POOL_UNKNOWN"
+	}
+}
+
+// acquires info of all storage pools of any type
+func getNodePools(ctx context.Context, c *libvirt.Connect) ([]nodePool, error) {
+	pools, err := listStorgePools(ctx, c, libvirt.ConnectListAllStoragePoolsFlags(0))
+	defer freePools(ctx, pools)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]nodePool, 0, len(pools))
+
+	for _, pool := range pools {
+		var poolDef nodePool
+
+		poolDef.Name, err = getPoolName(ctx, &pool)
+		if err != nil {
+			continue
+		}
+
+		poolInfo, err := getPoolInfo(ctx, &pool)
+		if err != nil {
+			continue
+		}
+
+		poolCfg, err := getPoolConfig(ctx, &pool)
+		if err != nil {
+			continue
+		}
+
+		poolDef.Type = poolCfg.Type
+
+		poolDef.Path, err = getPoolPath(ctx, &pool)
+		if err != nil {
+			poolDef.Path = ""
+		}
+
+		poolDef.State = getPoolStateName(poolInfo.State)
+
+		poolDef.Capacity = poolInfo.Capacity
+		poolDef.Allocation = poolInfo.Allocation
+		poolDef.Available = poolInfo.Available
+
+		poolDef.Autostart, err = isPoolAutostarted(ctx, &pool)
+		if err != nil {
+			poolDef.Autostart = false
+		}
+
+		poolDef.Active, err = isPoolActive(ctx, &pool)
+		if err != nil {
+			poolDef.Active = false
+		}
+
+		poolDef.Persistent, err = isPoolPersistent(ctx, &pool)
+		if err != nil {
+			poolDef.Persistent = false
+		}
+
+		// volumes of inactive pool can not be listed
+		if poolDef.Active {
+			poolDef.VolumesCount, err = countNumOfStorageVolumesInPool(ctx, &pool)
+			if err != nil {
+				poolDef.VolumesCount = 0
+			}
+
+			volumes, err := listPoolVolumes(ctx, &pool)
+			if err == nil {
+				catalogMutex.Lock()
+				catalog, err := loadPoolCatalog(ctx, poolDef.Name)
+				catalogMutex.Unlock()
+
+				if err != nil {
+					catalog = nil
+				}
+
+				for _, v := range volumes {
+					if _, ok := catalog[v]; ok || strings.Contains(v, "template") {
+						poolDef.Templates = append(poolDef.Templates, v)
+					}
+				}
+			}
+		}
+
+		r = append(r, poolDef)
+	}
+
+	return r, nil
+}
+
+// collects all problems of pool spec
+func validatePoolSpec(ctx context.Context, c *libvirt.Connect, spec *PoolSpec) []error {
+	problems := make([]error, 0)
+
+	ok, err := regexp.MatchString("^([0-9a-zA-Z]|-|_|\\.)+$", spec.Name)
+	if err != nil || !ok {
+		problems = append(problems, fmt.Errorf("not valid pool name, should contain only this symbols: (0-9,a-z,A-Z,_,-,.): %s", spec.Name))
+	} else if pool, err := c.LookupStoragePoolByName(spec.Name); err == nil {
+		freePool(ctx, pool)
+		problems = append(problems, fmt.Errorf("storage pool %s already exists", spec.Name))
+	}
+
+	needPath := func(what, value string) {
+		if len(value) == 0 || !strings.HasPrefix(value, "/") {
+			problems = append(problems, fmt.Errorf("%s pool requires absolute %s", spec.Type, what))
+		}
+	}
+
+	needValue := func(what, value string) {
+		if len(value) == 0 {
+			problems = append(problems, fmt.Errorf("%s pool requires %s", spec.Type, what))
+		}
+	}
+
+	switch spec.Type {
+	case poolTypeDir:
+		needPath("TargetPath", spec.TargetPath)
+
+	case poolTypeLogical:
+		needValue("SourceName (volume group)", spec.SourceName)
+
+		for _, dev := range spec.SourceDevices {
+			needPath("SourceDevices", dev)
+		}
+
+	case poolTypeNetFS:
+		needPath("TargetPath", spec.TargetPath)
+		needPath("SourcePath", spec.SourcePath)
+
+		if len(spec.Hosts) != 1 {
+			problems = append(problems, fmt.Errorf("%s pool requires exactly one host", spec.Type))
+		}
+
+		if len(spec.SourceFormat) != 0 && !isStringInSlice(spec.SourceFormat, []string{"auto", "nfs", "glusterfs", "cifs"}) {
+			problems = append(problems, fmt.Errorf("unknown netfs source format: %s", spec.SourceFormat))
+		}
+
+	case poolTypeRBD:
+		needValue("SourceName (ceph pool)", spec.SourceName)
+
+		if len(spec.Hosts) == 0 {
+			problems = append(problems, fmt.Errorf("%s pool requires at least one monitor host", spec.Type))
+		}
+
+		if len(spec.AuthUsername) != 0 {
+			needValue("AuthSecretUUID", spec.AuthSecretUUID)
+		}
+
+	case poolTypeISCSI:
+		needValue("SourcePath (target IQN)", spec.SourcePath)
+
+		if len(spec.Hosts) != 1 {
+			problems = append(problems, fmt.Errorf("%s pool requires exactly one host", spec.Type))
+		}
+
+		if len(spec.AuthUsername) != 0 {
+			needValue("AuthSecretUUID", spec.AuthSecretUUID)
+		}
+
+	default:
+		problems = append(problems, fmt.Errorf("unknown pool type: %s, supported: %s", spec.Type, strings.Join(poolSpecTypes, ", ")))
+	}
+
+	return problems
+}
+
+func getPoolSpecHosts(hosts []string) []libvirtxml.StoragePoolSourceHost {
+	r := make([]libvirtxml.StoragePoolSourceHost, 0, len(hosts))
+
+	for _, h := range hosts {
+		host := libvirtxml.StoragePoolSourceHost{Name: h}
+
+		if i := strings.LastIndex(h, ":"); i > 0 && !strings.HasSuffix(h, "]") {
+			host.Name = h[:i]
+			host.Port = h[i+1:]
+		}
+
+		r = append(r, host)
+	}
+
+	return r
+}
+
+func prepareXMLforPoolSpec(ctx context.Context, spec *PoolSpec) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	poolCfg := &libvirtxml.StoragePool{
+		Type:   spec.Type,
+		Name:   spec.Name,
+		Source: &libvirtxml.StoragePoolSource{},
+	}
+
+	if len(spec.TargetPath) != 0 {
+		poolCfg.Target = &libvirtxml.StoragePoolTarget{
+			Path: spec.TargetPath,
+		}
+	}
+
+	switch spec.Type {
+	case poolTypeLogical:
+		poolCfg.Source.Name = spec.SourceName
+		poolCfg.Source.Format = &libvirtxml.StoragePoolSourceFormat{Type: "lvm2"}
+
+		for _, dev := range spec.SourceDevices {
+			poolCfg.Source.Device = append(poolCfg.Source.Device, libvirtxml.StoragePoolSourceDevice{Path: dev})
+		}
+
+		if poolCfg.Target == nil {
+			poolCfg.Target = &libvirtxml.StoragePoolTarget{
+				Path: "/dev/" + spec.SourceName,
+			}
+		}
+
+	case poolTypeNetFS:
+		poolCfg.Source.Host = getPoolSpecHosts(spec.Hosts)
+		poolCfg.Source.Dir = &libvirtxml.StoragePoolSourceDir{Path: spec.SourcePath}
+
+		format := spec.SourceFormat
+		if len(format) == 0 {
+			format = "nfs"
+		}
+		poolCfg.Source.Format = &libvirtxml.StoragePoolSourceFormat{Type: format}
+
+	case poolTypeRBD:
+		poolCfg.Source.Name = spec.SourceName
+		poolCfg.Source.Host = getPoolSpecHosts(spec.Hosts)
+
+		if len(spec.AuthUsername) != 0 {
+			poolCfg.Source.Auth = &libvirtxml.StoragePoolSourceAuth{
+				Type:     "ceph",
+				Username: spec.AuthUsername,
+				Secret: &libvirtxml.StoragePoolSourceAuthSecret{
+					UUID: spec.AuthSecretUUID,
+				},
+			}
+		}
+
+	case poolTypeISCSI:
+		poolCfg.Source.Host = getPoolSpecHosts(spec.Hosts)
+		poolCfg.Source.Device = []libvirtxml.StoragePoolSourceDevice{
+			{Path: spec.SourcePath},
+		}
+
+		if len(spec.AuthUsername) != 0 {
+			poolCfg.Source.Auth = &libvirtxml.StoragePoolSourceAuth{
+				Type:     "chap",
+				Username: spec.AuthUsername,
+				Secret: &libvirtxml.StoragePoolSourceAuthSecret{
+					UUID: spec.AuthSecretUUID,
+				},
+			}
+		}
+
+		if poolCfg.Target == nil {
+			poolCfg.Target = &libvirtxml.StoragePoolTarget{
+				Path: "/dev/disk/by-path",
+			}
+		}
+
+	default:
+		poolCfg.Source = nil
+	}
+
+	xml, err := poolCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal storage pool XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	return xml, nil
+}
+
+// defines persistent storage pool, optionally builds, starts and marks it autostarted, defined pool is undefined on failure
+func definePoolFromSpec(ctx context.Context, c *libvirt.Connect, spec *PoolSpec) error {
+	id := getReqIDFromContext(ctx)
+
+	xml, err := prepareXMLforPoolSpec(ctx, spec)
+	if err != nil {
+		return err
+	}
+
+	tx := newTransaction(ctx)
+
+	var pool *libvirt.StoragePool
+
+	err = tx.do("define storage pool "+spec.Name,
+		func() error {
+			pool, err = c.StoragePoolDefineXML(xml, 0)
+			return err
+		},
+		func() error {
+			return pool.Undefine()
+		},
+	)
+	if err != nil {
+		fail.Printf("%sfailed to define storage pool %s: %s\n", id, spec.Name, err.Error())
+		return err
+	}
+	defer freePool(ctx, pool)
+
+	if spec.Build {
+		err = buildPool(ctx, pool)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	if spec.Start {
+		err = startPool(ctx, pool)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	if spec.Autostart {
+		err = setPoolAutostart(ctx, pool, true)
+		if err != nil {
+			if spec.Start {
+				_ = pool.Destroy()
+			}
+			tx.rollback()
+			return err
+		}
+	}
+
+	info.Printf("%sdefined storage pool %s of type %s\n", id, spec.Name, spec.Type)
+	return nil
+}
+
+func buildPool(ctx context.Context, p *libvirt.StoragePool) error {
+	id := getReqIDFromContext(ctx)
+
+	err := p.Build(libvirt.STORAGE_POOL_BUILD_NEW)
+	if err != nil {
+		fail.Printf("%sfailed to build storage pool: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sbuilt storage pool\n", id)
+	return nil
+}
+
+func startPool(ctx context.Context, p *libvirt.StoragePool) error {
+	id := getReqIDFromContext(ctx)
+
+	err := p.Create(libvirt.STORAGE_POOL_CREATE_NORMAL)
+	if err != nil {
+		fail.Printf("%sfailed to start storage pool: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sstarted storage pool\n", id)
+	return nil
+}
+
+func stopPool(ctx context.Context, p *libvirt.StoragePool) error {
+	id := getReqIDFromContext(ctx)
+
+	err := p.Destroy()
+	if err != nil {
+		fail.Printf("%sfailed to stop storage pool: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sstopped storage pool\n", id)
+	return nil
+}
+
+func setPoolAutostart(ctx context.Context, p *libvirt.StoragePool, autostart bool) error {
+	id := getReqIDFromContext(ctx)
+
+	err := p.SetAutostart(autostart)
+	if err != nil {
+		fail.Printf("%sfailed to set autostart for storage pool: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sset autostart for storage pool to %t\n", id, autostart)
+	return nil
+}
+
+// undefines inactive storage pool, optionally removing underlying storage (directory, volume group)
+func undefinePool(ctx context.Context, p *libvirt.StoragePool, deleteStorage bool) error {
+	id := getReqIDFromContext(ctx)
+
+	ok, err := isPoolActive(ctx, p)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return errors.New("storage pool must not be active while being undefined")
+	}
+
+	if deleteStorage {
+		err = p.Delete(libvirt.STORAGE_POOL_DELETE_NORMAL)
+		if err != nil {
+			fail.Printf("%sfailed to delete storage of storage pool: %s\n", id, err.Error())
+			return err
+		}
+		info.Printf("%sdeleted storage of storage pool\n", id)
+	}
+
+	err = p.Undefine()
+	if err != nil {
+		fail.Printf("%sfailed to undefine storage pool: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sundefined storage pool\n", id)
+	return nil
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+/* global variable declaration, if any... */
+const (
+	diskSourceTemplate = "template"
+	diskSourceEmpty    = "empty"
+	diskSourceVolume   = "volume"
+)
+
+var (
+	specDiskBuses = map[string]string{
+		"scsi":   "sd",
+		"sata":   "sd",
+		"virtio": "vd",
+		"ide":    "hd",
+	}
+	// target device names of bus, IDE has two channels with master and slave only: hda-hdd
+	specDiskBusSlots = map[string]int{
+		"scsi":   26,
+		"sata":   26,
+		"virtio": 26,
+		"ide":    4,
+	}
+	specDiskCacheModes = []string{"default", "none", "writethrough", "writeback", "directsync", "unsafe"}
+	specFirmwares      = []string{"bios", "efi"}
+	specBootDevices    = []string{"hd", "cdrom", "network"}
+)
+
+func isStringInSlice(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func setDomainSpecDefaults(ctx context.Context, spec *DomainSpec) {
+	if len(spec.UUID) == 0 {
+		spec.UUID = genUUID(ctx)
+	}
+
+	if spec.MaxVCPU == 0 {
+		spec.MaxVCPU = policy.MaxVCPUPerVM
+	}
+
+	if spec.MaxMemory == 0 {
+		spec.MaxMemory = getPolicyMaxMemory(spec.Memory)
+	}
+
+	if len(spec.Firmware) == 0 {
+		spec.Firmware = "bios"
+	}
+
+	if len(spec.BootOrder) == 0 {
+		spec.BootOrder = []string{"hd"}
+	}
+
+	for i := range spec.Disks {
+		if len(spec.Disks[i].Bus) == 0 {
+			spec.Disks[i].Bus = "scsi"
+		}
+
+		if len(spec.Disks[i].Cache) == 0 {
+			spec.Disks[i].Cache = "directsync"
+		}
+	}
+
+	for i := range spec.NICs {
+		if len(spec.NICs[i].MAC) == 0 {
+			spec.NICs[i].MAC = genMAC(ctx)
+		}
+	}
+}
+
+// target device names are allocated in spec order per bus prefix: sda, sdb, vda, ...
+func getDomainSpecDiskTargets(spec *DomainSpec) []string {
+	targets := make([]string, len(spec.Disks))
+	counters := make(map[string]int)
+
+	for i, disk := range spec.Disks {
+		prefix, ok := specDiskBuses[disk.Bus]
+		if !ok || counters[prefix] >= specDiskBusSlots[disk.Bus] {
+			continue
+		}
+
+		targets[i] = fmt.Sprintf("%s%c", prefix, 'a'+counters[prefix])
+		counters[prefix]++
+	}
+
+	return targets
+}
+
+func validateDomainSpec(ctx context.Context, c *libvirt.Connect, spec *DomainSpec, targets []string) []error {
+	problems := make([]error, 0)
+
+	_, err := isUUIDValid(ctx, spec.UUID)
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	_, err = isDomainNameValidAndAvailable(ctx, c, spec.Name)
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	if spec.VCPU <= 0 {
+		problems = append(problems, fmt.Errorf("vcpu count must be positive: %d", spec.VCPU))
+	} else if _, err = isVCPUAvailable(ctx, c, spec.VCPU); err != nil {
+		problems = append(problems, err)
+	}
+
+	if spec.MaxVCPU < spec.VCPU {
+		problems = append(problems, fmt.Errorf("max vcpu count %d is less than vcpu count %d", spec.MaxVCPU, spec.VCPU))
+	}
+
+	if spec.MaxVCPU > policy.MaxVCPUPerVM {
+		problems = append(problems, fmt.Errorf("max vcpu count %d is greater than allowed per domain: %d", spec.MaxVCPU, policy.MaxVCPUPerVM))
+	}
+
+	if spec.Memory == 0 {
+		problems = append(problems, errors.New("memory must be positive"))
+	} else if _, err = isMemoryAvailable(ctx, c, spec.Memory, spec.MaxMemory); err != nil {
+		problems = append(problems, err)
+	}
+
+	if spec.MaxMemory < spec.Memory {
+		problems = append(problems, fmt.Errorf("max memory %d KiB is less than memory %d KiB", spec.MaxMemory, spec.Memory))
+	}
+
+	_, err = loadDomainTemplate(ctx, spec.XMLTemplate)
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	if !isStringInSlice(spec.Firmware, specFirmwares) {
+		problems = append(problems, fmt.Errorf("unknown firmware: %s", spec.Firmware))
+	}
+
+	bootSeen := make(map[string]bool)
+	for _, dev := range spec.BootOrder {
+		if !isStringInSlice(dev, specBootDevices) {
+			problems = append(problems, fmt.Errorf("unknown boot device: %s", dev))
+		}
+
+		if bootSeen[dev] {
+			problems = append(problems, fmt.Errorf("duplicate boot device: %s", dev))
+		}
+		bootSeen[dev] = true
+	}
+
+	if len(spec.Disks) == 0 {
+		problems = append(problems, errors.New("domain must have at least one disk"))
+	}
+
+	var diskPaths map[string][]string
+
+	for i, disk := range spec.Disks {
+		if _, ok := specDiskBuses[disk.Bus]; !ok {
+			problems = append(problems, fmt.Errorf("disk %d: unknown bus: %s", i, disk.Bus))
+		} else if len(targets[i]) == 0 {
+			problems = append(problems, fmt.Errorf("disk %d: no free target device name on bus: %s", i, disk.Bus))
+		}
+
+		if !isStringInSlice(disk.Cache, specDiskCacheModes) {
+			problems = append(problems, fmt.Errorf("disk %d: unknown cache mode: %s", i, disk.Cache))
+		}
+
+		if disk.Linked && disk.Source != diskSourceTemplate {
+			problems = append(problems, fmt.Errorf("disk %d: only disk with template source can be linked clone", i))
+		}
+
+		switch disk.Source {
+		case diskSourceTemplate, diskSourceEmpty:
+			_, err = isStorageAvailable(ctx, c, disk.Storage)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("disk %d: %s", i, err.Error()))
+				continue
+			}
+
+			if disk.Source == diskSourceTemplate {
+				_, err = isTemplateInsideStorageAvailable(ctx, c, disk.Storage, disk.Template)
+				if err != nil {
+					problems = append(problems, fmt.Errorf("disk %d: %s", i, err.Error()))
+				}
+
+				// cloud-init seed is read by OS of first disk
+				_, err = checkImageTemplateRequirements(ctx, c, disk.Storage, disk.Template, spec.Memory, i == 0 && (len(spec.UserData) != 0 || len(spec.NetworkConfig) != 0))
+				if err != nil {
+					problems = append(problems, fmt.Errorf("disk %d: %s", i, err.Error()))
+				}
+
+				if disk.Linked {
+					poolType, err := getPoolType(ctx, c, disk.Storage)
+					if err != nil {
+						problems = append(problems, fmt.Errorf("disk %d: %s", i, err.Error()))
+					} else if !isPoolFileBased(poolType) {
+						problems = append(problems, fmt.Errorf("disk %d: linked clone requires file based storage pool, %s is %s pool", i, disk.Storage, poolType))
+					}
+				}
+			} else if disk.Size == 0 {
+				problems = append(problems, fmt.Errorf("disk %d: size of empty volume must be positive", i))
+			}
+
+			if len(targets[i]) == 0 {
+				continue
+			}
+
+			volPath, err := getPoolFilePath(ctx, c, disk.Storage, getDomainDiskImageName(spec.Name, i, targets[i]))
+			if err != nil {
+				problems = append(problems, fmt.Errorf("disk %d: %s", i, err.Error()))
+				continue
+			}
+
+			vol, err := lookupStorageVolByPath(ctx, c, volPath)
+			if err == nil {
+				freeVolume(ctx, vol)
+				problems = append(problems, fmt.Errorf("disk %d: image: %s exists", i, volPath))
+			}
+
+		case diskSourceVolume:
+			volPath, err := getPoolFilePath(ctx, c, disk.Storage, disk.Volume)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("disk %d: %s", i, err.Error()))
+				continue
+			}
+
+			vol, err := lookupStorageVolByPath(ctx, c, volPath)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("disk %d: volume %s does not exist in storage %s", i, disk.Volume, disk.Storage))
+				continue
+			}
+			freeVolume(ctx, vol)
+
+			if diskPaths == nil {
+				diskPaths, err = getDomainsDiskPaths(ctx, c)
+				if err != nil {
+					problems = append(problems, fmt.Errorf("disk %d: %s", i, err.Error()))
+					continue
+				}
+			}
+
+			if users, ok := diskPaths[volPath]; ok {
+				problems = append(problems, fmt.Errorf("disk %d: volume %s is used by domain(s): %s", i, volPath, strings.Join(users, ", ")))
+			}
+
+		default:
+			problems = append(problems, fmt.Errorf("disk %d: unknown source: %s", i, disk.Source))
+		}
+	}
+
+	macSeen := make(map[string]bool)
+	requestedVFs := make(map[string]int)
+	var rate uint
+
+	for i, nic := range spec.NICs {
+		_, err = isMACvalid(ctx, nic.MAC)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("nic %d: %s", i, err.Error()))
+		}
+
+		mac := strings.ToLower(nic.MAC)
+		if macSeen[mac] {
+			problems = append(problems, fmt.Errorf("nic %d: duplicate MAC: %s", i, nic.MAC))
+		}
+		macSeen[mac] = true
+
+		if len(nic.Network) == 0 {
+			problems = append(problems, fmt.Errorf("nic %d: network name can not be empty", i))
+		} else {
+			requestedVFs[nic.Network]++
+		}
+
+		// max_tx_rate is stored in domain metadata and applied to every VF of domain
+		if nic.Rate != 0 {
+			if rate != 0 && rate != nic.Rate {
+				problems = append(problems, fmt.Errorf("nic %d: rate %d differs from rate %d of other NICs, rate is applied per domain", i, nic.Rate, rate))
+			}
+			rate = nic.Rate
+		}
+	}
+
+	for network, requested := range requestedVFs {
+		free, err := getNetworkFreeVFCount(ctx, c, network)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+
+		if free < requested {
+			problems = append(problems, fmt.Errorf("network %s has %d free VF(s), %d requested", network, free, requested))
+		}
+	}
+
+	if len(spec.Tenant) != 0 {
+		_, err = isTenantNameValid(ctx, spec.Tenant)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			err = checkTenantQuota(ctx, c, spec.Tenant, getDomainSpecTenantUsage(ctx, c, spec, requestedVFs))
+			if err != nil {
+				problems = append(problems, err)
+			}
+		}
+	}
+
+	return problems
+}
+
+// usage added by spec, VFs are counted for SR-IOV (pf-) networks only
+func getDomainSpecTenantUsage(ctx context.Context, c *libvirt.Connect, spec *DomainSpec, requestedVFs map[string]int) TenantUsageResponse {
+	usage := TenantUsageResponse{
+		Domains: 1,
+		VCPUs:   spec.VCPU,
+		Memory:  uint64(spec.MaxMemory),
+	}
+
+	for _, disk := range spec.Disks {
+		switch disk.Source {
+		case diskSourceTemplate:
+			capacity, err := getVolumeCapacity(ctx, c, disk.Storage, disk.Template)
+			if err == nil {
+				usage.DiskBytes += capacity
+			}
+		case diskSourceEmpty:
+			usage.DiskBytes += disk.Size
+		case diskSourceVolume:
+			capacity, err := getVolumeCapacity(ctx, c, disk.Storage, disk.Volume)
+			if err == nil {
+				usage.DiskBytes += capacity
+			}
+		}
+	}
+
+	for network, requested := range requestedVFs {
+		if strings.HasPrefix(network, "pf-") {
+			usage.VFs += requested
+		}
+	}
+
+	return usage
+}
+
+func getDomainSpecNetworkRate(spec *DomainSpec) uint {
+	for _, nic := range spec.NICs {
+		if nic.Rate != 0 {
+			return nic.Rate
+		}
+	}
+
+	return 0
+}
+
+func prepareXMLforDomainSpec(ctx context.Context, spec *DomainSpec, disks []DomainTemplateDisk, targets []string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	domCfg, err := getNewDomainBaseConfig(ctx, spec.XMLTemplate, spec.UUID, spec.Name, spec.VCPU, spec.MaxVCPU, spec.Memory, spec.MaxMemory)
+	if err != nil {
+		return "", err
+	}
+
+	if domCfg.OS != nil {
+		if spec.Firmware == "efi" {
+			domCfg.OS.Firmware = "efi"
+		}
+
+		domCfg.OS.BootDevices = make([]libvirtxml.DomainBootDevice, 0, len(spec.BootOrder))
+		for _, dev := range spec.BootOrder {
+			domCfg.OS.BootDevices = append(domCfg.OS.BootDevices, libvirtxml.DomainBootDevice{
+				Dev: dev,
+			})
+		}
+	}
+
+	domCfg.Devices.Disks = make([]libvirtxml.DomainDisk, 0, len(spec.Disks))
+	for i, disk := range spec.Disks {
+		ioTune := getDomainDiskIOTune(disk.IOTune)
+
+		_, source := getDomainDiskSource(disks[i])
+
+		domCfg.Devices.Disks = append(domCfg.Devices.Disks, libvirtxml.DomainDisk{
+			Device: "disk",
+			Driver: &libvirtxml.DomainDiskDriver{
+				Name:         "qemu",
+				Type:         disks[i].Format,
+				Cache:        disk.Cache,
+				ErrorPolicy:  "enospace",
+				RErrorPolicy: "stop",
+				Discard:      "unmap",
+			},
+			Source: source,
+			Target: &libvirtxml.DomainDiskTarget{
+				Dev: targets[i],
+				Bus: disk.Bus,
+			},
+			IOTune: ioTune,
+		})
+	}
+
+	domCfg.Devices.Interfaces = make([]libvirtxml.DomainInterface, 0, len(spec.NICs))
+	for _, nic := range spec.NICs {
+		domCfg.Devices.Interfaces = append(domCfg.Devices.Interfaces, libvirtxml.DomainInterface{
+			MAC: &libvirtxml.DomainInterfaceMAC{
+				Address: nic.MAC,
+			},
+			Source: &libvirtxml.DomainInterfaceSource{
+				Network: &libvirtxml.DomainInterfaceSourceNetwork{
+					Network: nic.Network,
+				},
+			},
+			VLan: &libvirtxml.DomainInterfaceVLan{
+				Tags: []libvirtxml.DomainInterfaceVLanTag{
+					{
+						ID: nic.VLAN,
+					},
+				},
+			},
+		})
+	}
+
+	xml, err := domCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal domain XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	return xml, nil
+}
+
+func createDomainFromSpec(ctx context.Context, c *libvirt.Connect, spec *DomainSpec, targets []string) error {
+	id := getReqIDFromContext(ctx)
+
+	disks := make([]DomainTemplateDisk, len(spec.Disks))
+	tx := newTransaction(ctx)
+
+	for i, disk := range spec.Disks {
+		volName := disk.Volume
+		if disk.Source != diskSourceVolume {
+			volName = getDomainDiskImageName(spec.Name, i, targets[i])
+		}
+
+		var err error
+
+		switch disk.Source {
+		case diskSourceTemplate:
+			err = txCloneVolume(ctx, tx, c, disk.Storage, disk.Template, volName, disk.Linked)
+			if err == nil {
+				err = growVolumeToTemplateMinimum(ctx, c, disk.Storage, disk.Template, volName)
+			}
+		case diskSourceEmpty:
+			err = txCreateVolume(ctx, tx, c, disk.Storage, volName, disk.Size)
+		}
+
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+
+		disks[i], err = getPoolDomainTemplateDisk(ctx, c, disk.Storage, volName, "")
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	xml, err := prepareXMLforDomainSpec(ctx, spec, disks, targets)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+
+	if len(spec.UserData) != 0 || len(spec.NetworkConfig) != 0 {
+		seedPath, err := txWriteCloudInitSeed(ctx, tx, c, spec.Disks[0].Storage, spec.UUID, spec.Name, spec.UserData, spec.NetworkConfig)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+
+		xml, err = addCloudInitSeedToDomainXML(ctx, xml, seedPath)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	dom, err := txDefineDomain(ctx, tx, c, xml)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+	defer freeDomain(ctx, dom)
+
+	rate := getDomainSpecNetworkRate(spec)
+	if rate != 0 {
+		err = txSetDomainMetadataNetworkRate(ctx, tx, dom, rate)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	if spec.Autostart {
+		err = txSetDomainAutostart(ctx, tx, dom, true)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	if len(spec.Tenant) != 0 {
+		err = txSetDomainTenant(ctx, tx, dom, spec.Tenant)
+		if err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+
+	info.Printf("%screated domain %s from spec\n", id, spec.Name)
+	return nil
+}
@@ -261,3 +261,60 @@ func isNetworkVFAvailable(ctx context.Context, c *libvirt.Connect, network strin
 	info.Printf("%sVF(s): %d available\n", id, totalVFs-usedVFs)
 	return true, nil
 }
+
+func getNetworkFreeVFCount(ctx context.Context, c *libvirt.Connect, network string) (int, error) {
+	id := getReqIDFromContext(ctx)
+
+	net, err := lookupNetworkByName(ctx, c, network)
+	if err != nil {
+		return 0, fmt.Errorf("network %s does not exist: %s", network, err.Error())
+	}
+
+	usedVFs, totalVFs, err := getNetworkVFCount(ctx, c, net)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get list of interfaces inside network %s: %s", network, err.Error())
+	}
+
+	if usedVFs >= totalVFs {
+		info.Printf("%sVF(s): 0 available on network %s\n", id, network)
+		return 0, nil
+	}
+
+	info.Printf("%sVF(s): %d available on network %s\n", id, totalVFs-usedVFs, network)
+	return totalVFs - usedVFs, nil
+}
+
+// libvirt allocates VF on domain start, this returns first VF that is free right now
+func getNetworkFirstFreeVF(ctx context.Context, c *libvirt.Connect, network string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	net, err := lookupNetworkByName(ctx, c, network)
+	if err != nil {
+		return "", fmt.Errorf("network %s does not exist: %s", network, err.Error())
+	}
+
+	netHostDevPciDevices, err := getInterfacesFromNetwork(ctx, net)
+	if err != nil {
+		return "", fmt.Errorf("failed to get list of interfaces: %s", err.Error())
+	}
+
+	netDomainPciDevices, err := getDomainsNetworkDevices(ctx, c)
+	if err != nil {
+		return "", fmt.Errorf("failed to get list of pci devices: %s", err.Error())
+	}
+
+	used := make(map[string]bool)
+	for _, addr := range netDomainPciDevices {
+		used[addr] = true
+	}
+
+	for _, addr := range netHostDevPciDevices {
+		if !used[addr] {
+			info.Printf("%sfirst free VF on network %s: %s\n", id, network, addr)
+			return addr, nil
+		}
+	}
+
+	fail.Printf("%sno empty network VF available\n", id)
+	return "", fmt.Errorf("no empty network VF available")
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/libvirt/libvirt-go"
 	libvirtxml "github.com/libvirt/libvirt-go-xml"
@@ -65,8 +67,7 @@ func refreshPool(ctx context.Context, p *libvirt.StoragePool) error {
 func refreshAllStorgePools(ctx context.Context, c *libvirt.Connect) error {
 	id := getReqIDFromContext(ctx)
 
-	// here we acquire only directory based pools
-	pools, err := listStorgePools(ctx, c, libvirt.CONNECT_LIST_STORAGE_POOLS_DIR|libvirt.CONNECT_LIST_STORAGE_POOLS_ACTIVE)
+	pools, err := listStorgePools(ctx, c, libvirt.CONNECT_LIST_STORAGE_POOLS_ACTIVE)
 	defer freePools(ctx, pools)
 
 	if err != nil {
@@ -186,13 +187,11 @@ func cloneVolumeByPath(ctx context.Context, c *libvirt.Connect, storage, leftIma
 	}
 	defer freePool(ctx, pool)
 
-	poolPath, err := getPoolPath(ctx, pool)
+	volPath, err := getPoolFilePath(ctx, c, storage, rightImageName)
 	if err != nil {
 		return err
 	}
 
-	volPath := filepath.Clean(fmt.Sprintf("%s/%s", poolPath, rightImageName))
-
 	cloneVol, err := lookupStorageVolByName(ctx, c, pool, leftImageName)
 	if err != nil {
 		return err
@@ -217,7 +216,7 @@ func cloneVolumeByPath(ctx context.Context, c *libvirt.Connect, storage, leftIma
 	info.Printf("%sunmarshaled storage volume XML\n", id)
 
 	if volCfg.BackingStore != nil {
-		return fmt.Errorf("not cloning, volume has backing strore")
+		return fmt.Errorf("not cloning, volume has backing store")
 	}
 
 	volCfg.Name = rightImageName
@@ -232,7 +231,9 @@ func cloneVolumeByPath(ctx context.Context, c *libvirt.Connect, storage, leftIma
 		return fmt.Errorf("not cloning, volume has no target description")
 	}
 
+	// read-only mode of linked clone base is not inherited, pool default is used
 	volCfg.Target.Timestamps = nil
+	volCfg.Target.Permissions = nil
 	volCfg.Target.Path = volPath
 
 	xml, err = volCfg.Marshal()
@@ -253,13 +254,231 @@ func cloneVolumeByPath(ctx context.Context, c *libvirt.Connect, storage, leftIma
 	return nil
 }
 
-func getPoolPath(ctx context.Context, p *libvirt.StoragePool) (string, error) {
+// creates thin qcow2 overlay with template volume as read-only backing file
+func linkedCloneVolume(ctx context.Context, c *libvirt.Connect, storage, template, name string) error {
+	id := getReqIDFromContext(ctx)
+
+	pool, err := lookupPoolByName(ctx, c, storage)
+	if err != nil {
+		return err
+	}
+	defer freePool(ctx, pool)
+
+	poolCfg, err := getPoolConfig(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	if !isPoolFileBased(poolCfg.Type) {
+		fail.Printf("%slinked clone requires file based storage pool, %s is %s pool\n", id, storage, poolCfg.Type)
+		return fmt.Errorf("linked clone requires file based storage pool, %s is %s pool", storage, poolCfg.Type)
+	}
+
+	volPath, err := getPoolFilePath(ctx, c, storage, name)
+	if err != nil {
+		return err
+	}
+
+	baseVol, err := lookupStorageVolByName(ctx, c, pool, template)
+	if err != nil {
+		return err
+	}
+	defer freeVolume(ctx, baseVol)
+
+	base, err := getVolumeInfoResponse(ctx, baseVol, nil)
+	if err != nil {
+		return err
+	}
+
+	if len(base.BackingStore) != 0 {
+		return fmt.Errorf("not cloning, volume has backing store")
+	}
+
+	// base must not be written by anyone while it backs overlays, root still can, so RPCs check overlays as well
+	err = os.Chmod(base.Path, 0o444)
+	if err != nil {
+		fail.Printf("%sfailed to make base volume %s read-only: %s\n", id, base.Path, err.Error())
+		return err
+	}
+
+	volCfg := &libvirtxml.StorageVolume{
+		Type: "file",
+		Name: name,
+		Capacity: &libvirtxml.StorageVolumeSize{
+			Unit:  "bytes",
+			Value: base.Capacity,
+		},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Path: volPath,
+			Format: &libvirtxml.StorageVolumeTargetFormat{
+				Type: volumeFormatQcow2,
+			},
+		},
+		BackingStore: &libvirtxml.StorageVolumeBackingStore{
+			Path: base.Path,
+			Format: &libvirtxml.StorageVolumeTargetFormat{
+				Type: base.Format,
+			},
+		},
+	}
+
+	xml, err := volCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal XML from structure: %s\n", id, err.Error())
+		return err
+	}
+	info.Printf("%smarshaled storage volume XML\n", id)
+
+	newVol, err := pool.StorageVolCreateXML(xml, 0)
+	if err != nil {
+		fail.Printf("%sfailed to create linked clone using XML config: %s\n", id, err.Error())
+		return err
+	}
+	defer freeVolume(ctx, newVol)
+
+	info.Printf("%screated linked clone of %s/%s at path: %s\n", id, storage, template, volPath)
+	return nil
+}
+
+func createPoolVolume(ctx context.Context, c *libvirt.Connect, storage, name string, capacity uint64, format string) error {
+	id := getReqIDFromContext(ctx)
+
+	volPath, err := getPoolFilePath(ctx, c, storage, name)
+	if err != nil {
+		return err
+	}
+
+	pool, err := lookupPoolByName(ctx, c, storage)
+	if err != nil {
+		return err
+	}
+	defer freePool(ctx, pool)
+
+	poolCfg, err := getPoolConfig(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	volCfg := &libvirtxml.StorageVolume{
+		Name: name,
+		Capacity: &libvirtxml.StorageVolumeSize{
+			Unit:  "bytes",
+			Value: capacity,
+		},
+		Target: &libvirtxml.StorageVolumeTarget{
+			Path: volPath,
+		},
+	}
+
+	// volumes of block and network pools are always raw
+	if isPoolFileBased(poolCfg.Type) {
+		volCfg.Type = "file"
+		volCfg.Target.Format = &libvirtxml.StorageVolumeTargetFormat{
+			Type: format,
+		}
+	} else {
+		format = volumeFormatRaw
+	}
+
+	xml, err := volCfg.Marshal()
+	if err != nil {
+		fail.Printf("%sfailed to marshal XML from structure: %s\n", id, err.Error())
+		return err
+	}
+	info.Printf("%smarshaled storage volume XML\n", id)
+
+	newVol, err := pool.StorageVolCreateXML(xml, 0)
+	if err != nil {
+		fail.Printf("%sfailed to create volume using XML config: %s\n", id, err.Error())
+		return err
+	}
+	defer freeVolume(ctx, newVol)
+
+	info.Printf("%screated %s storage volume %s/%s with capacity %d bytes\n", id, format, storage, name, capacity)
+	return nil
+}
+
+// adds source paths of all disks (including CD-ROMs) of domain configuration
+func addDomainConfigSourcePaths(ctx context.Context, c *libvirt.Connect, domCfg *libvirtxml.Domain, paths map[string]bool) {
+	if domCfg.Devices == nil {
+		return
+	}
+
+	for _, disk := range domCfg.Devices.Disks {
+		if disk.Source == nil {
+			continue
+		}
+
+		switch {
+		case disk.Source.File != nil:
+			paths[disk.Source.File.File] = true
+		case disk.Source.Block != nil:
+			paths[disk.Source.Block.Dev] = true
+		case disk.Source.Volume != nil:
+			path, err := getPoolFilePath(ctx, c, disk.Source.Volume.Pool, disk.Source.Volume.Volume)
+			if err == nil {
+				paths[path] = true
+			}
+		}
+
+		// backing chain of running domain, e.g. overlay of external backup snapshot
+		for bs := disk.BackingStore; bs != nil && bs.Source != nil; bs = bs.BackingStore {
+			if bs.Source.File != nil {
+				paths[bs.Source.File.File] = true
+			}
+		}
+	}
+}
+
+// maps source paths of disks and CD-ROMs (ISO, cloud-init seed) of live and persistent configuration to names of domains using them
+func getDomainsDiskPaths(ctx context.Context, c *libvirt.Connect) (map[string][]string, error) {
+	id := getReqIDFromContext(ctx)
+
+	domains, err := listAllDomainsWithFlags(ctx, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer freeDomains(ctx, domains)
+
+	users := make(map[string][]string)
+
+	for i := range domains {
+		name := getDomainName(ctx, &domains[i])
+
+		paths := make(map[string]bool)
+
+		for _, flags := range []libvirt.DomainXMLFlags{0, libvirt.DOMAIN_XML_INACTIVE} {
+			xml, err := getDomainXML(ctx, &domains[i], flags)
+			if err != nil {
+				return nil, err
+			}
+
+			domCfg := &libvirtxml.Domain{}
+			err = domCfg.Unmarshal(xml)
+			if err != nil {
+				fail.Printf("%sfailed to parse domain XML: %s\n", id, err.Error())
+				return nil, err
+			}
+
+			addDomainConfigSourcePaths(ctx, c, domCfg, paths)
+		}
+
+		for path := range paths {
+			users[path] = append(users[path], name)
+		}
+	}
+
+	info.Printf("%sacquired disk paths of all domains\n", id)
+	return users, nil
+}
+
+func getPoolConfig(ctx context.Context, p *libvirt.StoragePool) (*libvirtxml.StoragePool, error) {
 	id := getReqIDFromContext(ctx)
 
 	xml, err := p.GetXMLDesc(libvirt.StorageXMLFlags(0))
 	if err != nil {
 		fail.Printf("%sfailed to get XML of storage pool: %s\n", id, err.Error())
-		return "", err
+		return nil, err
 	}
 	info.Printf("%sacquired storage pool XML\n", id)
 
@@ -267,19 +486,78 @@ func getPoolPath(ctx context.Context, p *libvirt.StoragePool) (string, error) {
 	err = poolCfg.Unmarshal(xml)
 	if err != nil {
 		fail.Printf("%sfailed to unmarshal storage pool XML: %s\n", id, err.Error())
-		return "", err
+		return nil, err
 	}
 	info.Printf("%sunmarshaled storage pool XML\n", id)
 
-	if poolCfg.Target != nil {
+	return poolCfg, nil
+}
+
+// returns target path of storage pool (directory, mount point, /dev/<vg>), network pools without target path return source name (rbd pool)
+func getPoolPath(ctx context.Context, p *libvirt.StoragePool) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	poolCfg, err := getPoolConfig(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	if poolCfg.Target != nil && len(poolCfg.Target.Path) != 0 {
 		info.Printf("%sacquired storage pool path\n", id)
 		return poolCfg.Target.Path, nil
 	}
 
+	if poolCfg.Source != nil && len(poolCfg.Source.Name) != 0 {
+		info.Printf("%sacquired storage pool source name\n", id)
+		return poolCfg.Source.Name, nil
+	}
+
 	fail.Printf("%sfailed to get storage pool path: %s\n", id, errors.New("empty target in storage pool XML"))
 	return "", errors.New("empty target in storage pool XML")
 }
 
+// returns path of volume inside storage pool, existing volume path is acquired from libvirt
+func getPoolFilePath(ctx context.Context, c *libvirt.Connect, storagePoolName, fileName string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	if len(fileName) == 0 || fileName != filepath.Base(fileName) || strings.HasPrefix(fileName, ".") {
+		fail.Printf("%snot valid file name: %s\n", id, fileName)
+		return "", fmt.Errorf("not valid file name: %s", fileName)
+	}
+
+	pool, err := lookupPoolByName(ctx, c, storagePoolName)
+	if err != nil {
+		return "", err
+	}
+	defer freePool(ctx, pool)
+
+	vol, err := pool.LookupStorageVolByName(fileName)
+	if err == nil {
+		defer freeVolume(ctx, vol)
+		return getVolumePath(ctx, vol)
+	}
+
+	poolCfg, err := getPoolConfig(ctx, pool)
+	if err != nil {
+		return "", err
+	}
+
+	if !isPoolVolumePathPredictable(poolCfg.Type) {
+		fail.Printf("%svolume path in storage pool %s of type %s is known only after volume is created\n", id, storagePoolName, poolCfg.Type)
+		return "", fmt.Errorf("volume path in storage pool %s of type %s is known only after volume is created", storagePoolName, poolCfg.Type)
+	}
+
+	poolPath, err := getPoolPath(ctx, pool)
+	if err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Clean(fmt.Sprintf("%s/%s", poolPath, fileName))
+
+	info.Printf("%sallocated file path inside storage pool %s: %s\n", id, storagePoolName, filePath)
+	return filePath, nil
+}
+
 func getPoolInfo(ctx context.Context, p *libvirt.StoragePool) (*libvirt.StoragePoolInfo, error) {
 	id := getReqIDFromContext(ctx)
 
@@ -404,7 +682,7 @@ func isStorageAvailable(ctx context.Context, c *libvirt.Connect, poolName string
 		return false, fmt.Errorf("storage pool %s is not running normally", poolName)
 	}
 
-	if poolInfo.Available < 50*1024*1024*1024 {
+	if poolInfo.Available < policy.MinPoolHeadroom {
 		fail.Printf("%sstorage pool %s free space at critical levels: %d bytes\n", id, poolName, poolInfo.Available)
 		return false, fmt.Errorf("storage pool %s free space at critical: levels %d bytes", poolName, poolInfo.Available)
 	}
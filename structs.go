@@ -320,6 +320,7 @@ type nodeMemoryStats struct {
 
 type nodePool struct {
 	Name         string   `json:"Name"`
+	Type         string   `json:"Type"` // dir, fs, netfs, logical, disk, iscsi, rbd, ...
 	State        string   `json:"State"`
 	Active       bool     `json:"Active"`
 	Persistent   bool     `json:"Persistent"`
@@ -331,3 +332,222 @@ type nodePool struct {
 	VolumesCount int      `json:"VolumesCount"`
 	Templates    []string `json:"Templates"`
 }
+
+// ShutdownResponse - struct for JRPC ShutdownAndWait function
+type ShutdownResponse struct {
+	Method   string  `json:"Method"`
+	Duration float64 `json:"Duration"` // seconds
+}
+
+// DomainSpec - struct for JRPC CreateFromSpec function
+type DomainSpec struct {
+	UUID          string           `json:"UUID"`
+	Name          string           `json:"Name"`
+	XMLTemplate   string           `json:"XMLTemplate"`
+	VCPU          int              `json:"VCPU"`
+	MaxVCPU       int              `json:"MaxVCPU"`
+	Memory        uint             `json:"Memory"`    // KiB
+	MaxMemory     uint             `json:"MaxMemory"` // KiB
+	Firmware      string           `json:"Firmware"`  // bios, efi
+	BootOrder     []string         `json:"BootOrder"` // hd, cdrom, network
+	Autostart     bool             `json:"Autostart"`
+	UserData      string           `json:"UserData"`      // cloud-init user-data
+	NetworkConfig string           `json:"NetworkConfig"` // cloud-init network-config
+	Tenant        string           `json:"Tenant"`        // owner of domain, checked against tenant quota
+	Disks         []DomainDiskSpec `json:"Disks"`
+	NICs          []DomainNICSpec  `json:"NICs"`
+}
+
+// DomainDiskSpec - disk part of DomainSpec
+type DomainDiskSpec struct {
+	Source   string   `json:"Source"` // template, empty, volume
+	Storage  string   `json:"Storage"`
+	Template string   `json:"Template"`
+	Linked   bool     `json:"Linked"` // template: thin qcow2 overlay instead of full copy
+	Volume   string   `json:"Volume"`
+	Size     uint64   `json:"Size"` // bytes
+	Bus      string   `json:"Bus"`  // scsi, virtio, sata, ide
+	Cache    string   `json:"Cache"`
+	IOTune   *blockIO `json:"IOTune"`
+}
+
+// DomainNICSpec - network interface part of DomainSpec
+type DomainNICSpec struct {
+	Network string `json:"Network"`
+	MAC     string `json:"MAC"`
+	VLAN    uint   `json:"VLAN"`
+	Rate    uint   `json:"Rate"` // Mbps
+}
+
+// DomainTemplateVars - typed variables available inside domain XML templates, also used by JRPC RenderTemplate function
+type DomainTemplateVars struct {
+	UUID      string               `json:"UUID"`
+	Name      string               `json:"Name"`
+	VCPU      int                  `json:"VCPU"`
+	MaxVCPU   int                  `json:"MaxVCPU"`
+	Memory    uint                 `json:"Memory"`    // KiB
+	MaxMemory uint                 `json:"MaxMemory"` // KiB
+	Disks     []DomainTemplateDisk `json:"Disks"`
+	NICs      []DomainTemplateNIC  `json:"NICs"`
+}
+
+// DomainTemplateDisk - disk part of DomainTemplateVars
+type DomainTemplateDisk struct {
+	Type   string `json:"Type"` // file (default), block, volume
+	Path   string `json:"Path"`
+	Pool   string `json:"Pool"`   // for volume type
+	Volume string `json:"Volume"` // for volume type
+	Format string `json:"Format"` // qcow2 (default), raw
+	Target string `json:"Target"`
+	Bus    string `json:"Bus"`
+}
+
+// DomainTemplateNIC - network interface part of DomainTemplateVars
+type DomainTemplateNIC struct {
+	MAC     string `json:"MAC"`
+	Network string `json:"Network"`
+	VLAN    uint   `json:"VLAN"`
+}
+
+type planCheck struct {
+	Name   string `json:"Name"`
+	Passed bool   `json:"Passed"`
+	Value  string `json:"Value"`
+	Error  string `json:"Error"`
+}
+
+// PlanCreateResponse - struct for JRPC PlanCreate function
+type PlanCreateResponse struct {
+	Ready     bool        `json:"Ready"`
+	Checks    []planCheck `json:"Checks"`
+	XML       string      `json:"XML"`
+	ImagePath string      `json:"ImagePath"`
+	VF        string      `json:"VF"` // PCI address, allocated by libvirt on domain start
+}
+
+// AdmissionPolicy - struct for JRPC GetAdmissionPolicy function
+type AdmissionPolicy struct {
+	CPUOvercommitRatio    float64                `json:"CPUOvercommitRatio"`    // assigned vCPUs per host core
+	MemoryOvercommitRatio float64                `json:"MemoryOvercommitRatio"` // assigned domain maximum memory per host memory without reserved
+	ReservedHostMemory    uint64                 `json:"ReservedHostMemory"`    // KiB
+	MinPoolHeadroom       uint64                 `json:"MinPoolHeadroom"`       // bytes
+	MaxVCPUPerVM          int                    `json:"MaxVCPUPerVM"`
+	MaxMemoryPerVM        uint                   `json:"MaxMemoryPerVM"` // KiB, 0 is unlimited
+	TenantQuotas          map[string]TenantQuota `json:"TenantQuotas"`
+}
+
+// TenantQuota - per tenant limits inside AdmissionPolicy, zero value is unlimited
+type TenantQuota struct {
+	Domains   int    `json:"Domains"`
+	VCPUs     int    `json:"VCPUs"`
+	Memory    uint64 `json:"Memory"`    // KiB, maximum memory of domains
+	DiskBytes uint64 `json:"DiskBytes"` // bytes, capacity of domain disks
+	VFs       int    `json:"VFs"`
+}
+
+// TenantUsageResponse - struct for JRPC TenantUsage function
+type TenantUsageResponse struct {
+	Tenant    string      `json:"Tenant"`
+	Domains   int         `json:"Domains"`
+	VCPUs     int         `json:"VCPUs"`
+	Memory    uint64      `json:"Memory"`    // KiB
+	DiskBytes uint64      `json:"DiskBytes"` // bytes
+	VFs       int         `json:"VFs"`
+	Quota     TenantQuota `json:"Quota"`
+}
+
+// BulkActionResult - struct for JRPC BulkAction function, per domain result
+type BulkActionResult struct {
+	Domain  string `json:"Domain"`
+	Success bool   `json:"Success"`
+	Skipped bool   `json:"Skipped"` // not run because of StopOnError
+	Error   string `json:"Error"`
+}
+
+// VolumeInfoResponse - struct for JRPC ListVolumes and VolumeInfo functions
+type VolumeInfoResponse struct {
+	Name         string   `json:"Name"`
+	Path         string   `json:"Path"`
+	Type         string   `json:"Type"`
+	Format       string   `json:"Format"`
+	Capacity     uint64   `json:"Capacity"`   // bytes
+	Allocation   uint64   `json:"Allocation"` // bytes
+	BackingStore string   `json:"BackingStore"`
+	UsedBy       []string `json:"UsedBy"` // domains with volume attached as disk
+}
+
+// PoolSpec - struct for JRPC DefinePool function
+type PoolSpec struct {
+	Name           string   `json:"Name"`
+	Type           string   `json:"Type"`           // dir, logical, netfs, rbd, iscsi
+	TargetPath     string   `json:"TargetPath"`     // dir: directory, netfs: mount point
+	Hosts          []string `json:"Hosts"`          // netfs, iscsi: server, rbd: monitors, host or host:port
+	SourcePath     string   `json:"SourcePath"`     // netfs: exported directory, iscsi: target IQN
+	SourceName     string   `json:"SourceName"`     // logical: volume group, rbd: ceph pool
+	SourceFormat   string   `json:"SourceFormat"`   // netfs: auto, nfs (default), glusterfs, cifs
+	SourceDevices  []string `json:"SourceDevices"`  // logical: physical volumes used by Build
+	AuthUsername   string   `json:"AuthUsername"`   // rbd: ceph user, iscsi: CHAP user
+	AuthSecretUUID string   `json:"AuthSecretUUID"` // libvirt secret with key or password
+	Build          bool     `json:"Build"`
+	Start          bool     `json:"Start"`
+	Autostart      bool     `json:"Autostart"`
+}
+
+// ImageTemplate - struct for template catalog entry of storage pool
+type ImageTemplate struct {
+	Name        string `json:"Name"` // volume name inside storage pool
+	OSFamily    string `json:"OSFamily"`
+	OSVersion   string `json:"OSVersion"`
+	MinDisk     uint64 `json:"MinDisk"`   // bytes, smaller cloned disk is grown by Create
+	MinMemory   uint64 `json:"MinMemory"` // KiB
+	DefaultUser string `json:"DefaultUser"`
+	SHA256      string `json:"SHA256"`
+	CloudInit   bool   `json:"CloudInit"`
+	Registered  bool   `json:"Registered"` // false for volume only named as template
+	Verified    string `json:"Verified"`   // RFC3339 time of last checksum verification
+}
+
+// VerifyImageTemplateResponse - struct for JRPC VerifyImageTemplate function
+type VerifyImageTemplateResponse struct {
+	Name     string `json:"Name"`
+	Expected string `json:"Expected"`
+	Actual   string `json:"Actual"`
+	Valid    bool   `json:"Valid"`
+}
+
+// BackupEntry - struct for backup catalog entry, backups, saved domain states and data volumes are never collected as orphans
+type BackupEntry struct {
+	Kind    string `json:"Kind"`
+	Source  string `json:"Source"`  // disk path of backup, domain name of saved state, pool of data volume
+	Created string `json:"Created"` // RFC3339
+}
+
+// OrphanVolume - struct for JRPC FindOrphans and CollectOrphans functions
+type OrphanVolume struct {
+	Pool       string `json:"Pool"`
+	Name       string `json:"Name"`
+	Path       string `json:"Path"`
+	Kind       string `json:"Kind"`       // disk, backup, cloud-init seed, volume
+	Allocation uint64 `json:"Allocation"` // bytes
+	Age        uint64 `json:"Age"`        // seconds since last modification
+	AgeKnown   bool   `json:"AgeKnown"`   // false for pools without volume timestamps
+	Removed    bool   `json:"Removed"`
+	Error      string `json:"Error"`
+}
+
+// ImportJobStatus - struct for JRPC ImportDisk, GetImportJob and ListImportJobs functions
+type ImportJobStatus struct {
+	ID         string  `json:"ID"`
+	Pool       string  `json:"Pool"`
+	SourcePath string  `json:"SourcePath"`
+	Format     string  `json:"Format"` // source format
+	TargetName string  `json:"TargetName"`
+	Path       string  `json:"Path"` // path of converted qcow2 volume
+	Domain     string  `json:"Domain"`
+	AttachedAs string  `json:"AttachedAs"` // target device of attached disk
+	State      string  `json:"State"`      // running, completed, failed
+	Progress   float64 `json:"Progress"`   // percent
+	Error      string  `json:"Error"`
+	Started    string  `json:"Started"`
+	Finished   string  `json:"Finished"`
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+/* global variable declaration, if any... */
+const (
+	defaultDomainTemplate  = "default"
+	domainTemplateFileExt  = ".xml"
+	domainTemplateNameChar = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-_."
+)
+
+//go:embed templates/default.xml
+var builtinDomainTemplate string // file with the same name inside templates directory overrides it
+
+var domainTemplateFuncs = template.FuncMap{
+	"xml": func(s string) (string, error) {
+		var b bytes.Buffer
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+	// iotune element with limits of default block IO profile
+	"defaultIOTune": func() (string, error) {
+		b, err := xml.Marshal(struct {
+			XMLName xml.Name `xml:"iotune"`
+			*libvirtxml.DomainDiskIOTune
+		}{DomainDiskIOTune: getDomainDiskIOTune(nil)})
+		return string(b), err
+	},
+}
+
+func isDomainTemplateNameValid(ctx context.Context, name string) (bool, error) {
+	id := getReqIDFromContext(ctx)
+
+	if len(name) == 0 || strings.HasPrefix(name, ".") || strings.Trim(name, domainTemplateNameChar) != "" {
+		fail.Printf("%snot valid template name: %s\n", id, name)
+		return false, fmt.Errorf("not valid template name: %s", name)
+	}
+
+	return true, nil
+}
+
+func listDomainTemplates(ctx context.Context) ([]string, error) {
+	id := getReqIDFromContext(ctx)
+
+	names := []string{defaultDomainTemplate}
+
+	files, err := os.ReadDir(*templatesDir)
+	if err != nil && !os.IsNotExist(err) {
+		fail.Printf("%sfailed to read templates directory %s: %s\n", id, *templatesDir, err.Error())
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != domainTemplateFileExt {
+			continue
+		}
+
+		name := strings.TrimSuffix(f.Name(), domainTemplateFileExt)
+		if ok, _ := isDomainTemplateNameValid(ctx, name); !ok || name == defaultDomainTemplate {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names[1:])
+
+	info.Printf("%sacquired list of domain templates\n", id)
+	return names, nil
+}
+
+func loadDomainTemplate(ctx context.Context, name string) (*template.Template, error) {
+	id := getReqIDFromContext(ctx)
+
+	if len(name) == 0 {
+		name = defaultDomainTemplate
+	}
+
+	ok, err := isDomainTemplateNameValid(ctx, name)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	text := builtinDomainTemplate
+
+	data, err := os.ReadFile(filepath.Join(*templatesDir, name+domainTemplateFileExt))
+	switch {
+	case err == nil:
+		text = string(data)
+	case os.IsNotExist(err) && name == defaultDomainTemplate:
+		info.Printf("%susing built-in domain template\n", id)
+	case os.IsNotExist(err):
+		fail.Printf("%sdomain template %s does not exist\n", id, name)
+		return nil, fmt.Errorf("domain template %s does not exist", name)
+	default:
+		fail.Printf("%sfailed to read domain template %s: %s\n", id, name, err.Error())
+		return nil, err
+	}
+
+	tmpl, err := template.New(name).Funcs(domainTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		fail.Printf("%sfailed to parse domain template %s: %s\n", id, name, err.Error())
+		return nil, fmt.Errorf("failed to parse domain template %s: %s", name, err.Error())
+	}
+
+	info.Printf("%sloaded domain template %s\n", id, name)
+	return tmpl, nil
+}
+
+func renderDomainTemplate(ctx context.Context, name string, vars DomainTemplateVars) (*libvirtxml.Domain, error) {
+	id := getReqIDFromContext(ctx)
+
+	tmpl, err := loadDomainTemplate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	err = tmpl.Execute(&b, vars)
+	if err != nil {
+		fail.Printf("%sfailed to render domain template %s: %s\n", id, name, err.Error())
+		return nil, fmt.Errorf("failed to render domain template %s: %s", name, err.Error())
+	}
+
+	domCfg := &libvirtxml.Domain{}
+	err = domCfg.Unmarshal(b.String())
+	if err != nil {
+		fail.Printf("%sfailed to unmarshal domain XML rendered from template %s: %s\n", id, name, err.Error())
+		return nil, fmt.Errorf("failed to unmarshal domain XML rendered from template %s: %s", name, err.Error())
+	}
+
+	info.Printf("%srendered domain template %s\n", id, name)
+	return domCfg, nil
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+/* global variable declaration, if any... */
+const (
+	metaTenantURI = "1c5537ac-8c84-4313-a8e7-9dd8d45ac7ed/tenant"
+	metaTenantKey = "tenant"
+)
+
+type tenantMetadata struct {
+	XMLName xml.Name `xml:"tenant"`
+	Name    string   `xml:",chardata"`
+}
+
+func isTenantNameValid(ctx context.Context, tenant string) (bool, error) {
+	id := getReqIDFromContext(ctx)
+
+	ok, err := regexp.MatchString("^([0-9a-zA-Z]|-|_|\\.)+$", tenant)
+	if err != nil || !ok {
+		fail.Printf("%snot valid tenant, should contain only this symbols: (0-9,a-z,A-Z,_,-,.): %s\n", id, tenant)
+		return false, fmt.Errorf("not valid tenant, should contain only this symbols: (0-9,a-z,A-Z,_,-,.): %s", tenant)
+	}
+
+	return true, nil
+}
+
+// returns empty string for domain without tenant
+func getDomainTenant(ctx context.Context, d *libvirt.Domain) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	data, err := d.GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, metaTenantURI, libvirt.DOMAIN_AFFECT_CONFIG)
+	if err != nil {
+		if lverr, ok := err.(libvirt.Error); ok && lverr.Code == libvirt.ERR_NO_DOMAIN_METADATA {
+			return "", nil
+		}
+
+		fail.Printf("%sfailed to get domain tenant metadata: %s\n", id, err.Error())
+		return "", err
+	}
+
+	var meta tenantMetadata
+
+	err = xml.Unmarshal([]byte(data), &meta)
+	if err != nil {
+		fail.Printf("%sfailed to unmarshal tenant metadata XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	info.Printf("%sacquired domain tenant %s\n", id, meta.Name)
+	return strings.TrimSpace(meta.Name), nil
+}
+
+func setDomainTenant(ctx context.Context, d *libvirt.Domain, tenant string) error {
+	id := getReqIDFromContext(ctx)
+
+	data, err := xml.Marshal(tenantMetadata{Name: tenant})
+	if err != nil {
+		fail.Printf("%sfailed to marshal tenant metadata for domain: %s\n", id, err.Error())
+		return err
+	}
+
+	err = d.SetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, string(data), metaTenantKey, metaTenantURI, libvirt.DOMAIN_AFFECT_CONFIG)
+	if err != nil {
+		fail.Printf("%sfailed to set tenant metadata for domain: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sset domain tenant to %s\n", id, tenant)
+	return nil
+}
+
+func txSetDomainTenant(ctx context.Context, tx *transaction, d *libvirt.Domain, tenant string) error {
+	return tx.do("set tenant metadata",
+		func() error {
+			return setDomainTenant(ctx, d, tenant)
+		},
+		func() error {
+			return d.SetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, "", metaTenantKey, metaTenantURI, libvirt.DOMAIN_AFFECT_CONFIG)
+		},
+	)
+}
+
+// returns tenant recorded in metadata of domain XML, e.g. copied by clone or supplied to DefineXML, empty string for domain without tenant
+func getDomainConfigTenant(ctx context.Context, domCfg *libvirtxml.Domain) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	if domCfg.Metadata == nil {
+		return "", nil
+	}
+
+	dec := xml.NewDecoder(strings.NewReader("<metadata>" + domCfg.Metadata.XML + "</metadata>"))
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			fail.Printf("%sfailed to parse domain metadata XML: %s\n", id, err.Error())
+			return "", err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Space != metaTenantURI || start.Name.Local != metaTenantKey {
+			continue
+		}
+
+		var meta tenantMetadata
+
+		err = dec.DecodeElement(&meta, &start)
+		if err != nil {
+			fail.Printf("%sfailed to unmarshal tenant metadata XML: %s\n", id, err.Error())
+			return "", err
+		}
+
+		return strings.TrimSpace(meta.Name), nil
+	}
+}
+
+// usage added by domain defined from XML config: vCPUs, maximum memory and VFs, disks are existing volumes
+func getDomainConfigTenantUsage(ctx context.Context, domCfg *libvirtxml.Domain) (TenantUsageResponse, error) {
+	usage := TenantUsageResponse{
+		Domains: 1,
+		VFs:     countDomainConfigVFs(domCfg),
+	}
+
+	if domCfg.VCPU != nil {
+		usage.VCPUs = int(domCfg.VCPU.Current)
+		if usage.VCPUs == 0 {
+			usage.VCPUs = int(domCfg.VCPU.Value)
+		}
+	}
+
+	if domCfg.Memory != nil {
+		memory, err := memoryToKiB(ctx, domCfg.Memory.Value, domCfg.Memory.Unit)
+		if err != nil {
+			return usage, err
+		}
+
+		usage.Memory = uint64(memory)
+	}
+
+	return usage, nil
+}
+
+// checks quota of tenant recorded in domain XML before domain is defined
+func checkDomainConfigTenantQuota(ctx context.Context, c *libvirt.Connect, domCfg *libvirtxml.Domain) error {
+	tenant, err := getDomainConfigTenant(ctx, domCfg)
+	if err != nil || len(tenant) == 0 {
+		return err
+	}
+
+	usage, err := getDomainConfigTenantUsage(ctx, domCfg)
+	if err != nil {
+		return err
+	}
+
+	return checkTenantQuota(ctx, c, tenant, usage)
+}
+
+func countDomainVFs(ctx context.Context, d *libvirt.Domain) int {
+	domCfg, err := getDomainInactiveConfig(ctx, d)
+	if err != nil {
+		return 0
+	}
+
+	return countDomainConfigVFs(domCfg)
+}
+
+func countDomainConfigVFs(domCfg *libvirtxml.Domain) int {
+	var count int
+
+	if domCfg.Devices == nil {
+		return 0
+	}
+
+	for _, iface := range domCfg.Devices.Interfaces {
+		if iface.Source != nil && iface.Source.Network != nil && strings.HasPrefix(iface.Source.Network.Network, "pf-") {
+			count++
+		}
+	}
+
+	return count
+}
+
+// sums usage of all domains of tenant using GetAllDomainStats
+func getTenantUsage(ctx context.Context, c *libvirt.Connect, tenant string) (TenantUsageResponse, error) {
+	id := getReqIDFromContext(ctx)
+
+	usage := TenantUsageResponse{
+		Tenant: tenant,
+		Quota:  policy.TenantQuotas[tenant],
+	}
+
+	domains, err := listAllDomainsWithFlags(ctx, c, 0)
+	if err != nil {
+		return usage, err
+	}
+	defer freeDomains(ctx, domains)
+
+	owned := make([]*libvirt.Domain, 0)
+	for i := range domains {
+		t, err := getDomainTenant(ctx, &domains[i])
+		if err != nil {
+			return usage, err
+		}
+
+		if t == tenant {
+			owned = append(owned, &domains[i])
+		}
+	}
+
+	if len(owned) == 0 {
+		info.Printf("%stenant %s has no domains\n", id, tenant)
+		return usage, nil
+	}
+
+	stats, err := getDomainsStats(ctx, c, owned, libvirt.DOMAIN_STATS_VCPU|libvirt.DOMAIN_STATS_BALLOON|libvirt.DOMAIN_STATS_BLOCK)
+	if err != nil {
+		return usage, err
+	}
+
+	for _, s := range stats {
+		usage.Domains++
+
+		var vcpus int
+		for _, v := range s.Vcpu {
+			if v.StateSet && v.State != libvirt.VCPU_OFFLINE {
+				vcpus++
+			}
+		}
+
+		// per vCPU state is reported only for active domains
+		if vcpus == 0 && s.Domain != nil {
+			num, err := s.Domain.GetVcpusFlags(libvirt.DOMAIN_VCPU_CONFIG)
+			if err == nil {
+				vcpus = int(num)
+			}
+		}
+
+		usage.VCPUs += vcpus
+
+		if s.Balloon != nil && s.Balloon.MaximumSet {
+			usage.Memory += s.Balloon.Maximum
+		}
+
+		for _, b := range s.Block {
+			if b.CapacitySet {
+				usage.DiskBytes += b.Capacity
+			}
+		}
+
+		if s.Domain != nil {
+			usage.VFs += countDomainVFs(ctx, s.Domain)
+			freeDomain(ctx, s.Domain)
+		}
+	}
+
+	info.Printf("%sacquired usage of tenant %s\n", id, tenant)
+	return usage, nil
+}
+
+// checks that tenant usage increased by delta stays within tenant quota, zero quota value is unlimited
+func checkTenantQuota(ctx context.Context, c *libvirt.Connect, tenant string, delta TenantUsageResponse) error {
+	id := getReqIDFromContext(ctx)
+
+	if len(tenant) == 0 {
+		return nil
+	}
+
+	quota, ok := policy.TenantQuotas[tenant]
+	if !ok {
+		return nil
+	}
+
+	usage, err := getTenantUsage(ctx, c, tenant)
+	if err != nil {
+		return err
+	}
+
+	problems := make([]string, 0)
+
+	if quota.Domains != 0 && usage.Domains+delta.Domains > quota.Domains {
+		problems = append(problems, fmt.Sprintf("domains: %d + %d > %d", usage.Domains, delta.Domains, quota.Domains))
+	}
+
+	if quota.VCPUs != 0 && usage.VCPUs+delta.VCPUs > quota.VCPUs {
+		problems = append(problems, fmt.Sprintf("vCPUs: %d + %d > %d", usage.VCPUs, delta.VCPUs, quota.VCPUs))
+	}
+
+	if quota.Memory != 0 && usage.Memory+delta.Memory > quota.Memory {
+		problems = append(problems, fmt.Sprintf("memory: %d + %d > %d KiB", usage.Memory, delta.Memory, quota.Memory))
+	}
+
+	if quota.DiskBytes != 0 && usage.DiskBytes+delta.DiskBytes > quota.DiskBytes {
+		problems = append(problems, fmt.Sprintf("disk: %d + %d > %d bytes", usage.DiskBytes, delta.DiskBytes, quota.DiskBytes))
+	}
+
+	if quota.VFs != 0 && usage.VFs+delta.VFs > quota.VFs {
+		problems = append(problems, fmt.Sprintf("VFs: %d + %d > %d", usage.VFs, delta.VFs, quota.VFs))
+	}
+
+	if len(problems) != 0 {
+		fail.Printf("%stenant %s quota exceeded: %s\n", id, tenant, strings.Join(problems, ", "))
+		return fmt.Errorf("tenant %s quota exceeded: %s", tenant, strings.Join(problems, ", "))
+	}
+
+	info.Printf("%stenant %s is within quota\n", id, tenant)
+	return nil
+}
+
+func getVolumeCapacity(ctx context.Context, c *libvirt.Connect, storage, volume string) (uint64, error) {
+	id := getReqIDFromContext(ctx)
+
+	path, err := getPoolFilePath(ctx, c, storage, volume)
+	if err != nil {
+		return 0, err
+	}
+
+	vol, err := lookupStorageVolByPath(ctx, c, path)
+	if err != nil {
+		return 0, err
+	}
+	defer freeVolume(ctx, vol)
+
+	volInfo, err := vol.GetInfo()
+	if err != nil {
+		fail.Printf("%sfailed to get storage volume info for %s: %s\n", id, path, err.Error())
+		return 0, err
+	}
+
+	return volInfo.Capacity, nil
+}
+
+// checks quota of domain tenant for new vCPUs or maximum memory [KiB] values, zero value is left unchanged,
+// memory quota counts maximum memory, so current memory is not checked
+func checkDomainTenantQuota(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain, vCPUs uint, memory uint64) error {
+	id := getReqIDFromContext(ctx)
+
+	tenant, err := getDomainTenant(ctx, d)
+	if err != nil || len(tenant) == 0 {
+		return err
+	}
+
+	var delta TenantUsageResponse
+
+	if vCPUs != 0 {
+		current := getDomainCurrentVCPUs(ctx, d)
+		if uint64(vCPUs) > current {
+			delta.VCPUs = int(uint64(vCPUs) - current)
+		}
+	}
+
+	if memory != 0 {
+		current, err := d.GetMaxMemory()
+		if err != nil {
+			fail.Printf("%sfailed to get maximum memory for domain: %s\n", id, err.Error())
+			return err
+		}
+
+		if memory > current {
+			delta.Memory = memory - current
+		}
+	}
+
+	if delta.VCPUs == 0 && delta.Memory == 0 {
+		return nil
+	}
+
+	return checkTenantQuota(ctx, c, tenant, delta)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+
+	"github.com/libvirt/libvirt-go"
+)
+
+type txStep struct {
+	name string
+	undo func() error
+}
+
+// transaction records completed side effects so they can be compensated in reverse order
+type transaction struct {
+	ctx   context.Context
+	steps []txStep
+}
+
+func newTransaction(ctx context.Context) *transaction {
+	return &transaction{
+		ctx:   ctx,
+		steps: make([]txStep, 0),
+	}
+}
+
+// do runs action and, on success, records undo as compensating action for it
+func (t *transaction) do(name string, action, undo func() error) error {
+	id := getReqIDFromContext(t.ctx)
+
+	err := action()
+	if err != nil {
+		fail.Printf("%stransaction step %s failed: %s\n", id, name, err.Error())
+		return err
+	}
+
+	t.steps = append(t.steps, txStep{name: name, undo: undo})
+
+	info.Printf("%stransaction step %s done\n", id, name)
+	return nil
+}
+
+// rollback undoes all completed steps in reverse order, undo errors are logged and do not stop rollback
+func (t *transaction) rollback() {
+	id := getReqIDFromContext(t.ctx)
+
+	for i := len(t.steps) - 1; i >= 0; i-- {
+		step := t.steps[i]
+		if step.undo == nil {
+			continue
+		}
+
+		err := step.undo()
+		if err != nil {
+			fail.Printf("%sfailed to undo transaction step %s: %s\n", id, step.name, err.Error())
+			continue
+		}
+
+		info.Printf("%sundone transaction step %s\n", id, step.name)
+	}
+
+	t.steps = t.steps[:0]
+}
+
+func removeVolumeByPath(ctx context.Context, c *libvirt.Connect, path string) error {
+	vol, err := lookupStorageVolByPath(ctx, c, path)
+	if err != nil {
+		return err
+	}
+	defer freeVolume(ctx, vol)
+
+	return deletePoolVolume(ctx, vol, libvirt.STORAGE_VOL_DELETE_NORMAL)
+}
+
+// linked clone is thin overlay over template instead of full copy
+func txCloneVolume(ctx context.Context, tx *transaction, c *libvirt.Connect, storage, template, volName string, linked bool) error {
+	path, err := getPoolFilePath(ctx, c, storage, volName)
+	if err != nil {
+		return err
+	}
+
+	return tx.do("clone volume "+path,
+		func() error {
+			if linked {
+				return linkedCloneVolume(ctx, c, storage, template, volName)
+			}
+
+			return cloneVolumeByPath(ctx, c, storage, template, volName)
+		},
+		func() error {
+			return removeVolumeByPath(ctx, c, path)
+		},
+	)
+}
+
+func txCreateVolume(ctx context.Context, tx *transaction, c *libvirt.Connect, storage, volName string, capacity uint64) error {
+	path, err := getPoolFilePath(ctx, c, storage, volName)
+	if err != nil {
+		return err
+	}
+
+	return tx.do("create volume "+path,
+		func() error {
+			return createPoolVolume(ctx, c, storage, volName, capacity, volumeFormatQcow2)
+		},
+		func() error {
+			return removeVolumeByPath(ctx, c, path)
+		},
+	)
+}
+
+// returned domain object must be freed by caller
+func txDefineDomain(ctx context.Context, tx *transaction, c *libvirt.Connect, xml string) (*libvirt.Domain, error) {
+	var dom *libvirt.Domain
+
+	err := tx.do("define domain",
+		func() error {
+			var err error
+			dom, err = defineDomain(ctx, c, xml)
+			return err
+		},
+		func() error {
+			return undefineDomain(ctx, dom, libvirt.DOMAIN_UNDEFINE_MANAGED_SAVE|libvirt.DOMAIN_UNDEFINE_SNAPSHOTS_METADATA|libvirt.DOMAIN_UNDEFINE_NVRAM)
+		},
+	)
+
+	return dom, err
+}
+
+func txSetDomainMetadataNetworkRate(ctx context.Context, tx *transaction, d *libvirt.Domain, rate uint) error {
+	meta, err := getDomainMetadata(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	return tx.do("set network rate metadata",
+		func() error {
+			_, err := setDomainMetadataNetworkRate(ctx, d, rate)
+			return err
+		},
+		func() error {
+			_, err := setDomainMetadataNetworkRate(ctx, d, meta.MaxTxRate)
+			return err
+		},
+	)
+}
+
+func txSetDomainAutostart(ctx context.Context, tx *transaction, d *libvirt.Domain, autoStart bool) error {
+	return tx.do("set autostart",
+		func() error {
+			return setDomainAutostart(ctx, d, autoStart)
+		},
+		func() error {
+			return setDomainAutostart(ctx, d, !autoStart)
+		},
+	)
+}
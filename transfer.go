@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/libvirt/libvirt-go"
+)
+
+/* global variable declaration, if any... */
+const (
+	transferURLPrefix      = "/volumes/"
+	transferChecksumHeader = "X-Checksum-SHA256"
+	transferFormatHeader   = "X-Volume-Format"
+	transferUploadIDHeader = "X-Upload-ID"
+	transferChunkSize      = 1 << 20
+)
+
+var (
+	transferZeroChunk = make([]byte, transferChunkSize)
+
+	pendingUploads sync.Map // <pool>/<volume> -> pendingUpload, volumes created by first chunk of unfinished chunked upload, kept in memory until restart
+)
+
+type pendingUpload struct {
+	id    string
+	total uint64
+}
+
+// byte range of volume, length 0 means up to the end of volume
+type transferRange struct {
+	offset uint64
+	length uint64
+	total  uint64
+}
+
+// parses "bytes=first-last", "bytes=first-" and "bytes=-suffix" forms of Range header, multiple ranges are not supported
+func parseRangeHeader(header string, size uint64) (transferRange, error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header || strings.Contains(spec, ",") {
+		return transferRange{}, fmt.Errorf("not supported range: %s", header)
+	}
+
+	bounds := strings.SplitN(spec, "-", 2)
+	if len(bounds) != 2 {
+		return transferRange{}, fmt.Errorf("not valid range: %s", header)
+	}
+
+	if len(bounds[0]) == 0 {
+		suffix, err := strconv.ParseUint(bounds[1], 10, 64)
+		if err != nil || suffix == 0 {
+			return transferRange{}, fmt.Errorf("not valid range: %s", header)
+		}
+
+		if suffix > size {
+			suffix = size
+		}
+
+		return transferRange{offset: size - suffix, length: suffix, total: size}, nil
+	}
+
+	first, err := strconv.ParseUint(bounds[0], 10, 64)
+	if err != nil || first >= size {
+		return transferRange{}, fmt.Errorf("not satisfiable range: %s", header)
+	}
+
+	last := size - 1
+
+	if len(bounds[1]) != 0 {
+		last, err = strconv.ParseUint(bounds[1], 10, 64)
+		if err != nil || last < first {
+			return transferRange{}, fmt.Errorf("not valid range: %s", header)
+		}
+
+		if last >= size {
+			last = size - 1
+		}
+	}
+
+	return transferRange{offset: first, length: last - first + 1, total: size}, nil
+}
+
+// parses "bytes first-last/total" form of Content-Range header used for chunked uploads
+func parseContentRangeHeader(header string) (transferRange, error) {
+	spec := strings.TrimPrefix(header, "bytes ")
+	if spec == header {
+		return transferRange{}, fmt.Errorf("not valid content range: %s", header)
+	}
+
+	var first, last, total uint64
+
+	_, err := fmt.Sscanf(spec, "%d-%d/%d", &first, &last, &total)
+	if err != nil || last < first || last >= total {
+		return transferRange{}, fmt.Errorf("not valid content range: %s", header)
+	}
+
+	return transferRange{offset: first, length: last - first + 1, total: total}, nil
+}
+
+// returns size of volume data as it is streamed, which differs from capacity for qcow2 images
+func getVolumeTransferSize(ctx context.Context, v *libvirt.StorageVol) (uint64, error) {
+	id := getReqIDFromContext(ctx)
+
+	volInfo, err := v.GetInfoFlags(libvirt.STORAGE_VOL_GET_PHYSICAL)
+	if err != nil {
+		fail.Printf("%sfailed to get physical size of storage volume: %s\n", id, err.Error())
+		return 0, err
+	}
+
+	return volInfo.Allocation, nil
+}
+
+func getVolumeFormat(ctx context.Context, v *libvirt.StorageVol) string {
+	r, err := getVolumeInfoResponse(ctx, v, nil)
+	if err != nil {
+		return ""
+	}
+
+	return r.Format
+}
+
+// streams volume data into writer, holes of sparse stream are written as zeros
+func downloadVolume(ctx context.Context, c *libvirt.Connect, v *libvirt.StorageVol, rng transferRange, sparse bool, w io.Writer) error {
+	id := getReqIDFromContext(ctx)
+
+	stream, err := c.NewStream(0)
+	if err != nil {
+		fail.Printf("%sfailed to create stream: %s\n", id, err.Error())
+		return err
+	}
+	defer func() {
+		if err := stream.Free(); err != nil {
+			fail.Printf("%sfailed to free stream: %s\n", id, err.Error())
+		}
+	}()
+
+	var flags libvirt.StorageVolDownloadFlags
+	if sparse {
+		flags = libvirt.STORAGE_VOL_DOWNLOAD_SPARSE_STREAM
+	}
+
+	err = v.Download(stream, rng.offset, rng.length, flags)
+	if err != nil {
+		fail.Printf("%sfailed to start storage volume download: %s\n", id, err.Error())
+		return err
+	}
+
+	sink := func(s *libvirt.Stream, data []byte) (int, error) {
+		return w.Write(data)
+	}
+
+	if sparse {
+		hole := func(s *libvirt.Stream, length int64) error {
+			for length > 0 {
+				n := int64(len(transferZeroChunk))
+				if length < n {
+					n = length
+				}
+
+				_, err := w.Write(transferZeroChunk[:n])
+				if err != nil {
+					return err
+				}
+
+				length -= n
+			}
+
+			return nil
+		}
+
+		err = stream.SparseRecvAll(sink, hole)
+	} else {
+		err = stream.RecvAll(sink)
+	}
+
+	if err != nil {
+		fail.Printf("%sfailed to download storage volume: %s\n", id, err.Error())
+		if abortErr := stream.Abort(); abortErr != nil {
+			fail.Printf("%sfailed to abort stream: %s\n", id, abortErr.Error())
+		}
+		return err
+	}
+
+	err = stream.Finish()
+	if err != nil {
+		fail.Printf("%sfailed to finish stream: %s\n", id, err.Error())
+		return err
+	}
+
+	info.Printf("%sdownloaded %d bytes of storage volume from offset %d\n", id, rng.length, rng.offset)
+	return nil
+}
+
+// streams reader into volume, with sparse stream zero chunks are sent as holes, checksum is verified before stream is finished
+func uploadVolume(ctx context.Context, c *libvirt.Connect, v *libvirt.StorageVol, rng transferRange, sparse bool, r io.Reader, checksum string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	stream, err := c.NewStream(0)
+	if err != nil {
+		fail.Printf("%sfailed to create stream: %s\n", id, err.Error())
+		return "", err
+	}
+	defer func() {
+		if err := stream.Free(); err != nil {
+			fail.Printf("%sfailed to free stream: %s\n", id, err.Error())
+		}
+	}()
+
+	var flags libvirt.StorageVolUploadFlags
+	if sparse {
+		flags = libvirt.STORAGE_VOL_UPLOAD_SPARSE_STREAM
+	}
+
+	err = v.Upload(stream, rng.offset, rng.length, flags)
+	if err != nil {
+		fail.Printf("%sfailed to start storage volume upload: %s\n", id, err.Error())
+		return "", err
+	}
+
+	h := sha256.New()
+
+	written, err := sendToStream(stream, io.TeeReader(io.LimitReader(r, int64(rng.length)), h), sparse)
+	if err == nil && written != rng.length {
+		err = fmt.Errorf("request body is %d bytes, expected %d bytes", written, rng.length)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if err == nil && len(checksum) != 0 && !strings.EqualFold(checksum, sum) {
+		err = fmt.Errorf("checksum mismatch, expected %s, received data has %s", checksum, sum)
+	}
+
+	if err != nil {
+		fail.Printf("%sfailed to upload storage volume: %s\n", id, err.Error())
+		if abortErr := stream.Abort(); abortErr != nil {
+			fail.Printf("%sfailed to abort stream: %s\n", id, abortErr.Error())
+		}
+		return "", err
+	}
+
+	err = stream.Finish()
+	if err != nil {
+		fail.Printf("%sfailed to finish stream: %s\n", id, err.Error())
+		return "", err
+	}
+
+	info.Printf("%suploaded %d bytes of storage volume to offset %d\n", id, rng.length, rng.offset)
+	return sum, nil
+}
+
+func sendToStream(stream *libvirt.Stream, r io.Reader, sparse bool) (uint64, error) {
+	var written uint64
+
+	buf := make([]byte, transferChunkSize)
+
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if sparse && bytes.Equal(buf[:n], transferZeroChunk[:n]) {
+				if holeErr := stream.SendHole(int64(n), 0); holeErr != nil {
+					return written, holeErr
+				}
+			} else {
+				for sent := 0; sent < n; {
+					m, sendErr := stream.Send(buf[sent:n])
+					if sendErr != nil {
+						return written, sendErr
+					}
+
+					sent += m
+				}
+			}
+
+			written += uint64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// refuses transfer of volume attached to active domain
+func checkVolumeNotInUse(ctx context.Context, c *libvirt.Connect, path string) error {
+	users, err := getVolumeUsers(ctx, c, path)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		d, err := lookupDomainByName(ctx, c, user)
+		if err != nil {
+			return err
+		}
+
+		active := isDomainActive(ctx, d)
+		freeDomain(ctx, d)
+
+		if active {
+			return fmt.Errorf("volume %s is used by active domain %s", path, user)
+		}
+	}
+
+	return nil
+}
+
+func transferError(w http.ResponseWriter, err error, code int) {
+	http.Error(w, err.Error(), code)
+}
+
+// volumeTransferHandler - serves /volumes/<pool>/<volume>, GET and HEAD download volume, PUT uploads volume
+func volumeTransferHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, transferURLPrefix), "/")
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			transferError(w, errors.New("path should be /volumes/<pool>/<volume>"), http.StatusNotFound)
+			return
+		}
+
+		pool, name := parts[0], parts[1]
+
+		if isLockedAndMakeLock(ctx, pool+"/"+name, 10) {
+			transferError(w, errors.New("thread safety lock, function is temporarily unavailable"), http.StatusServiceUnavailable)
+			return
+		}
+
+		sparse, _ := strconv.ParseBool(r.URL.Query().Get("sparse"))
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			serveVolumeDownload(ctx, w, r, pool, name, sparse)
+
+		case http.MethodPut:
+			serveVolumeUpload(ctx, w, r, pool, name, sparse)
+
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT")
+			transferError(w, fmt.Errorf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func serveVolumeDownload(ctx context.Context, w http.ResponseWriter, r *http.Request, pool, name string, sparse bool) {
+	// libvirt refuses volume download on read-only connection
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		transferError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer closeConnection(ctx, c)
+
+	v, err := lookupPoolVolume(ctx, c, pool, name)
+	if err != nil {
+		transferError(w, err, http.StatusNotFound)
+		return
+	}
+	defer freeVolume(ctx, v)
+
+	path, err := getVolumePath(ctx, v)
+	if err != nil {
+		transferError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = checkVolumeNotInUse(ctx, c, path)
+	if err != nil {
+		transferError(w, err, http.StatusConflict)
+		return
+	}
+
+	size, err := getVolumeTransferSize(ctx, v)
+	if err != nil {
+		transferError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rng := transferRange{length: size, total: size}
+	status := http.StatusOK
+
+	if header := r.Header.Get("Range"); len(header) != 0 {
+		rng, err = parseRangeHeader(header, size)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			transferError(w, err, http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.offset, rng.offset+rng.length-1, size))
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatUint(rng.length, 10))
+	w.Header().Set(transferFormatHeader, getVolumeFormat(ctx, v))
+
+	if r.Method == http.MethodHead || rng.length == 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Trailer", transferChecksumHeader)
+	w.WriteHeader(status)
+
+	h := sha256.New()
+
+	err = downloadVolume(ctx, c, v, rng, sparse, io.MultiWriter(w, h))
+	if err != nil {
+		// headers are already sent, client notices short body and missing checksum trailer
+		return
+	}
+
+	w.Header().Set(transferChecksumHeader, hex.EncodeToString(h.Sum(nil)))
+}
+
+// only volume created by earlier chunk of the same upload accepts ranged writes
+func checkPendingUpload(key, uploadID string, total uint64) error {
+	v, ok := pendingUploads.Load(key)
+	if !ok {
+		return fmt.Errorf("volume %s already exists and is not target of unfinished upload", key)
+	}
+
+	u := v.(pendingUpload)
+	if len(uploadID) == 0 || u.id != uploadID {
+		return fmt.Errorf("volume %s is target of another upload, %s header does not match", key, transferUploadIDHeader)
+	}
+
+	if u.total != total {
+		return fmt.Errorf("volume %s is uploaded with total size %d, chunk has %d", key, u.total, total)
+	}
+
+	return nil
+}
+
+func serveVolumeUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, pool, name string, sparse bool) {
+	id := getReqIDFromContext(ctx)
+
+	var (
+		rng     transferRange
+		err     error
+		created bool
+	)
+
+	key := pool + "/" + name
+	uploadID := r.Header.Get(transferUploadIDHeader)
+
+	ranged := len(r.Header.Get("Content-Range")) != 0
+	if ranged {
+		rng, err = parseContentRangeHeader(r.Header.Get("Content-Range"))
+		if err != nil {
+			transferError(w, err, http.StatusBadRequest)
+			return
+		}
+	} else {
+		if r.ContentLength <= 0 {
+			transferError(w, errors.New("request must have Content-Length or Content-Range header"), http.StatusLengthRequired)
+			return
+		}
+
+		rng = transferRange{length: uint64(r.ContentLength), total: uint64(r.ContentLength)}
+	}
+
+	if r.ContentLength >= 0 && uint64(r.ContentLength) != rng.length {
+		transferError(w, fmt.Errorf("content length %d does not match range length %d", r.ContentLength, rng.length), http.StatusBadRequest)
+		return
+	}
+
+	c, err := openConnection(ctx, "rw")
+	if err != nil {
+		transferError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer closeConnection(ctx, c)
+
+	p, err := lookupPoolByName(ctx, c, pool)
+	if err != nil {
+		transferError(w, err, http.StatusNotFound)
+		return
+	}
+	defer freePool(ctx, p)
+
+	v, err := p.LookupStorageVolByName(name)
+	if err != nil {
+		// whole image or first chunk creates volume sized for complete image, format is detected by pool refresh
+		if rng.offset != 0 || len(uploadID) != 0 {
+			pendingUploads.Delete(key)
+			transferError(w, fmt.Errorf("volume %s does not exist, upload must start from offset 0 without %s header", key, transferUploadIDHeader), http.StatusConflict)
+			return
+		}
+
+		err = createPoolVolume(ctx, c, pool, name, rng.total, volumeFormatRaw)
+		if err != nil {
+			transferError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		created = true
+
+		if ranged {
+			uploadID = genUUID(ctx)
+		}
+
+		v, err = lookupStorageVolByName(ctx, c, p, name)
+		if err != nil {
+			transferError(w, err, http.StatusInternalServerError)
+			return
+		}
+	} else {
+		err = fmt.Errorf("volume %s already exists", key)
+		if ranged {
+			err = checkPendingUpload(key, uploadID, rng.total)
+		}
+
+		if err != nil {
+			freeVolume(ctx, v)
+			transferError(w, err, http.StatusConflict)
+			return
+		}
+	}
+	defer freeVolume(ctx, v)
+
+	path, err := getVolumePath(ctx, v)
+	if err != nil {
+		transferError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = checkVolumeNotInUse(ctx, c, path)
+	if err != nil {
+		transferError(w, err, http.StatusConflict)
+		return
+	}
+
+	err = checkVolumeHasNoOverlays(ctx, c, path)
+	if err != nil {
+		transferError(w, err, http.StatusConflict)
+		return
+	}
+
+	sum, err := uploadVolume(ctx, c, v, rng, sparse, r.Body, r.Header.Get(transferChecksumHeader))
+	if err != nil {
+		if created {
+			if delErr := deletePoolVolume(ctx, v, libvirt.STORAGE_VOL_DELETE_NORMAL); delErr != nil {
+				fail.Printf("%sfailed to remove partially uploaded volume %s: %s\n", id, path, delErr.Error())
+			}
+		}
+
+		transferError(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	// failed chunk keeps upload pending, so it can be resent with the same upload ID
+	if ranged {
+		if rng.offset+rng.length == rng.total {
+			pendingUploads.Delete(key)
+		} else {
+			pendingUploads.Store(key, pendingUpload{id: uploadID, total: rng.total})
+			w.Header().Set(transferUploadIDHeader, uploadID)
+		}
+	}
+
+	// refresh detects format of uploaded image and lists volumes named as templates in pool templates
+	err = refreshPool(ctx, p)
+	if err != nil {
+		transferError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// completed upload of volume named as template is registered in catalog, checksum of whole image must match volume data
+	if strings.Contains(name, "template") && rng.offset+rng.length == rng.total {
+		t := ImageTemplate{Name: name}
+		if !ranged {
+			t.SHA256 = sum
+		}
+
+		_, err = registerImageTemplate(ctx, c, pool, t)
+		if err != nil {
+			fail.Printf("%sfailed to register uploaded template %s: %s\n", id, key, err.Error())
+		}
+	}
+
+	vol, err := lookupStorageVolByName(ctx, c, p, name)
+	if err != nil {
+		transferError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer freeVolume(ctx, vol)
+
+	resp, err := getVolumeInfoResponse(ctx, vol, nil)
+	if err != nil {
+		transferError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(transferChecksumHeader, sum)
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		fail.Printf("%sfailed to write upload response: %s\n", id, err.Error())
+	}
+}
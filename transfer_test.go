@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseRangeHeader(t *testing.T) {
+	tests := []struct {
+		header  string
+		size    uint64
+		want    transferRange
+		wantErr bool
+	}{
+		{header: "bytes=0-99", size: 1000, want: transferRange{offset: 0, length: 100, total: 1000}},
+		{header: "bytes=100-", size: 1000, want: transferRange{offset: 100, length: 900, total: 1000}},
+		{header: "bytes=-100", size: 1000, want: transferRange{offset: 900, length: 100, total: 1000}},
+		{header: "bytes=-2000", size: 1000, want: transferRange{offset: 0, length: 1000, total: 1000}},
+		{header: "bytes=900-2000", size: 1000, want: transferRange{offset: 900, length: 100, total: 1000}},
+		{header: "bytes=999-999", size: 1000, want: transferRange{offset: 999, length: 1, total: 1000}},
+		{header: "bytes=1000-", size: 1000, wantErr: true},
+		{header: "bytes=100-99", size: 1000, wantErr: true},
+		{header: "bytes=-0", size: 1000, wantErr: true},
+		{header: "bytes=0-99,200-299", size: 1000, wantErr: true},
+		{header: "items=0-99", size: 1000, wantErr: true},
+		{header: "bytes=a-99", size: 1000, wantErr: true},
+		{header: "bytes=0", size: 1000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRangeHeader(tt.header, tt.size)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRangeHeader(%q, %d) = %+v, expected error", tt.header, tt.size, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseRangeHeader(%q, %d) error: %v", tt.header, tt.size, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("parseRangeHeader(%q, %d) = %+v, want %+v", tt.header, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestParseContentRangeHeader(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    transferRange
+		wantErr bool
+	}{
+		{header: "bytes 0-1023/2048", want: transferRange{offset: 0, length: 1024, total: 2048}},
+		{header: "bytes 1024-2047/2048", want: transferRange{offset: 1024, length: 1024, total: 2048}},
+		{header: "bytes 0-0/1", want: transferRange{offset: 0, length: 1, total: 1}},
+		{header: "bytes 1024-2048/2048", wantErr: true},
+		{header: "bytes 100-99/2048", wantErr: true},
+		{header: "bytes 0-1023/*", wantErr: true},
+		{header: "bytes */2048", wantErr: true},
+		{header: "0-1023/2048", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseContentRangeHeader(tt.header)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseContentRangeHeader(%q) = %+v, expected error", tt.header, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseContentRangeHeader(%q) error: %v", tt.header, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("parseContentRangeHeader(%q) = %+v, want %+v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPendingUpload(t *testing.T) {
+	pendingUploads.Store("images/pending.qcow2", pendingUpload{id: "upload-1", total: 2048})
+	defer pendingUploads.Delete("images/pending.qcow2")
+
+	tests := []struct {
+		key      string
+		uploadID string
+		total    uint64
+		wantErr  bool
+	}{
+		{key: "images/pending.qcow2", uploadID: "upload-1", total: 2048},
+		{key: "images/pending.qcow2", uploadID: "", total: 2048, wantErr: true},
+		{key: "images/pending.qcow2", uploadID: "upload-2", total: 2048, wantErr: true},
+		{key: "images/pending.qcow2", uploadID: "upload-1", total: 4096, wantErr: true},
+		{key: "images/existing.qcow2", uploadID: "upload-1", total: 2048, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := checkPendingUpload(tt.key, tt.uploadID, tt.total)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkPendingUpload(%q, %q, %d) error: %v, expected error: %t", tt.key, tt.uploadID, tt.total, err, tt.wantErr)
+		}
+	}
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
 )
 
 func validateCreateDomain(ctx context.Context, c *libvirt.Connect, uuid, name string, vCPU int, memory uint, storage, template, network, mac string) (bool, error) {
@@ -22,7 +26,7 @@ func validateCreateDomain(ctx context.Context, c *libvirt.Connect, uuid, name st
 		return false, err
 	}
 
-	ok, err = isMemoryAvailable(ctx, c, memory)
+	ok, err = isMemoryAvailable(ctx, c, memory, getPolicyMaxMemory(memory))
 	if err != nil || !ok {
 		return false, err
 	}
@@ -61,7 +65,7 @@ func checkResources(ctx context.Context, c *libvirt.Connect, name string, vCPU i
 		return false, err
 	}
 
-	ok, err = isMemoryAvailable(ctx, c, memory)
+	ok, err = isMemoryAvailable(ctx, c, memory, getPolicyMaxMemory(memory))
 	if err != nil || !ok {
 		return false, err
 	}
@@ -78,3 +82,146 @@ func checkResources(ctx context.Context, c *libvirt.Connect, name string, vCPU i
 
 	return true, nil
 }
+
+// checks new current or maximum vCPU count of existing domain, maximum is limited only per domain
+func validateDomainVCPUs(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain, vCPU uint, maximum bool) (bool, error) {
+	id := getReqIDFromContext(ctx)
+
+	if !maximum {
+		return isVCPUChangeAvailable(ctx, c, int(vCPU), getDomainCurrentVCPUs(ctx, d))
+	}
+
+	if vCPU == 0 {
+		fail.Printf("%smaximum vCPU can not be 0\n", id)
+		return false, errors.New("maximum vCPU can not be 0")
+	}
+
+	if int(vCPU) > policy.MaxVCPUPerVM {
+		fail.Printf("%samount of maximum vCPUs: %d are greater than allowed per domain: %d\n", id, vCPU, policy.MaxVCPUPerVM)
+		return false, fmt.Errorf("amount of maximum vCPUs: %d are greater than allowed per domain: %d", vCPU, policy.MaxVCPUPerVM)
+	}
+
+	return true, nil
+}
+
+// checks new current or maximum memory [KiB] of existing domain, admission counts maximum memory, so current memory keeps maximum unchanged
+func validateDomainMemory(ctx context.Context, c *libvirt.Connect, d *libvirt.Domain, memory uint64, maximum bool) (bool, error) {
+	id := getReqIDFromContext(ctx)
+
+	current, err := d.GetMaxMemory()
+	if err != nil {
+		fail.Printf("%sfailed to get maximum memory for domain: %s\n", id, err.Error())
+		return false, err
+	}
+
+	maxMemory := current
+	if maximum {
+		maxMemory = memory
+	}
+
+	return isMemoryChangeAvailable(ctx, c, uint(memory), uint(maxMemory), current)
+}
+
+func validateDefineDomain(ctx context.Context, c *libvirt.Connect, domCfg *libvirtxml.Domain) (bool, error) {
+	ok, err := isUUIDValid(ctx, domCfg.UUID)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	ok, err = isDomainNameValidAndAvailable(ctx, c, domCfg.Name)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if domCfg.VCPU == nil {
+		return false, errors.New("vcpu section in domain XML is empty")
+	}
+
+	vCPU := domCfg.VCPU.Current
+	if vCPU == 0 {
+		vCPU = domCfg.VCPU.Value
+	}
+
+	ok, err = isVCPUAvailable(ctx, c, int(vCPU))
+	if err != nil || !ok {
+		return false, err
+	}
+
+	var memory uint
+
+	switch {
+	case domCfg.CurrentMemory != nil:
+		memory, err = memoryToKiB(ctx, domCfg.CurrentMemory.Value, domCfg.CurrentMemory.Unit)
+	case domCfg.Memory != nil:
+		memory, err = memoryToKiB(ctx, domCfg.Memory.Value, domCfg.Memory.Unit)
+	default:
+		err = errors.New("memory section in domain XML is empty")
+	}
+	if err != nil {
+		return false, err
+	}
+
+	maxMemory := memory
+	if domCfg.Memory != nil {
+		maxMemory, err = memoryToKiB(ctx, domCfg.Memory.Value, domCfg.Memory.Unit)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	ok, err = isMemoryAvailable(ctx, c, memory, maxMemory)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if domCfg.Devices == nil {
+		return false, errors.New("devices section in domain XML is empty")
+	}
+
+	for _, disk := range domCfg.Devices.Disks {
+		if disk.Device != "disk" || disk.Source == nil || disk.Source.File == nil {
+			continue
+		}
+
+		vol, err := lookupStorageVolByPath(ctx, c, disk.Source.File.File)
+		if err != nil {
+			return false, fmt.Errorf("disk: %s is not a storage pool volume: %s", disk.Source.File.File, err.Error())
+		}
+
+		pool, err := lookupPoolByVolume(ctx, vol)
+		freeVolume(ctx, vol)
+		if err != nil {
+			return false, err
+		}
+
+		poolName, err := getPoolName(ctx, pool)
+		freePool(ctx, pool)
+		if err != nil {
+			return false, err
+		}
+
+		ok, err = isStorageAvailable(ctx, c, poolName)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	for _, iface := range domCfg.Devices.Interfaces {
+		if iface.MAC != nil {
+			ok, err = isMACvalid(ctx, iface.MAC.Address)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+
+		// only SR-IOV pools (pf-<interface>) hand out VFs, other networks are not limited
+		if iface.Source != nil && iface.Source.Network != nil && strings.HasPrefix(iface.Source.Network.Network, "pf-") {
+			ok, err = isNetworkVFAvailable(ctx, c, iface.Source.Network.Network)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+
+	return true, nil
+}
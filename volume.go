@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+/* global variable declaration, if any... */
+const (
+	volumeFormatQcow2 = "qcow2"
+	volumeFormatRaw   = "raw"
+)
+
+var volumeFormats = []string{volumeFormatQcow2, volumeFormatRaw}
+
+func getVolumeInfoResponse(ctx context.Context, v *libvirt.StorageVol, users map[string][]string) (VolumeInfoResponse, error) {
+	id := getReqIDFromContext(ctx)
+
+	xml, err := v.GetXMLDesc(0)
+	if err != nil {
+		fail.Printf("%sfailed to get storage volume XML: %s\n", id, err.Error())
+		return VolumeInfoResponse{}, err
+	}
+
+	volCfg := &libvirtxml.StorageVolume{}
+	err = volCfg.Unmarshal(xml)
+	if err != nil {
+		fail.Printf("%sfailed to unmarshal storage volume XML: %s\n", id, err.Error())
+		return VolumeInfoResponse{}, err
+	}
+
+	volInfo, err := v.GetInfo()
+	if err != nil {
+		fail.Printf("%sfailed to get storage volume info: %s\n", id, err.Error())
+		return VolumeInfoResponse{}, err
+	}
+
+	path, err := getVolumePath(ctx, v)
+	if err != nil {
+		return VolumeInfoResponse{}, err
+	}
+
+	r := VolumeInfoResponse{
+		Name:       volCfg.Name,
+		Path:       path,
+		Type:       volCfg.Type,
+		Capacity:   volInfo.Capacity,
+		Allocation: volInfo.Allocation,
+		UsedBy:     users[path],
+	}
+
+	if volCfg.Target != nil && volCfg.Target.Format != nil {
+		r.Format = volCfg.Target.Format.Type
+	}
+
+	if volCfg.BackingStore != nil {
+		r.BackingStore = volCfg.BackingStore.Path
+	}
+
+	if r.UsedBy == nil {
+		r.UsedBy = []string{}
+	}
+
+	return r, nil
+}
+
+func listPoolVolumesInfo(ctx context.Context, c *libvirt.Connect, pool string) ([]VolumeInfoResponse, error) {
+	id := getReqIDFromContext(ctx)
+
+	p, err := lookupPoolByName(ctx, c, pool)
+	if err != nil {
+		return nil, err
+	}
+	defer freePool(ctx, p)
+
+	err = refreshPool(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := getDomainsDiskPaths(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	vols, err := listAllStorgeVolumesInPool(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer freeVolumes(ctx, vols)
+
+	r := make([]VolumeInfoResponse, 0, len(vols))
+
+	for i := range vols {
+		v, err := getVolumeInfoResponse(ctx, &vols[i], users)
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, v)
+	}
+
+	info.Printf("%sacquired info of %d volume(s) in storage pool %s\n", id, len(r), pool)
+	return r, nil
+}
+
+// returned volume object must be freed by caller
+func lookupPoolVolume(ctx context.Context, c *libvirt.Connect, pool, name string) (*libvirt.StorageVol, error) {
+	p, err := lookupPoolByName(ctx, c, pool)
+	if err != nil {
+		return nil, err
+	}
+	defer freePool(ctx, p)
+
+	return lookupStorageVolByName(ctx, c, p, name)
+}
+
+func getVolumeUsers(ctx context.Context, c *libvirt.Connect, path string) ([]string, error) {
+	users, err := getDomainsDiskPaths(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return users[path], nil
+}
+
+// deletes volume not referenced by any domain
+func deleteUnusedPoolVolume(ctx context.Context, c *libvirt.Connect, pool, name string) error {
+	id := getReqIDFromContext(ctx)
+
+	v, err := lookupPoolVolume(ctx, c, pool, name)
+	if err != nil {
+		return err
+	}
+	defer freeVolume(ctx, v)
+
+	path, err := getVolumePath(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	users, err := getVolumeUsers(ctx, c, path)
+	if err != nil {
+		return err
+	}
+
+	if len(users) != 0 {
+		fail.Printf("%svolume %s is used by domain(s): %s\n", id, path, strings.Join(users, ", "))
+		return fmt.Errorf("volume %s is used by domain(s): %s", path, strings.Join(users, ", "))
+	}
+
+	err = checkVolumeHasNoOverlays(ctx, c, path)
+	if err != nil {
+		return err
+	}
+
+	err = deletePoolVolume(ctx, v, libvirt.STORAGE_VOL_DELETE_NORMAL)
+	if err != nil {
+		return err
+	}
+
+	// deleted backup or saved domain state
+	return removeBackupCatalogEntry(ctx, path)
+}
+
+// returns target device of disk with supplied source path
+func getDomainDiskTargetByPath(ctx context.Context, d *libvirt.Domain, path string) (string, error) {
+	id := getReqIDFromContext(ctx)
+
+	xml, err := d.GetXMLDesc(0)
+	if err != nil {
+		fail.Printf("%sfailed to get Domain XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	domCfg := &libvirtxml.Domain{}
+	err = domCfg.Unmarshal(xml)
+	if err != nil {
+		fail.Printf("%sfailed to parse Domain XML: %s\n", id, err.Error())
+		return "", err
+	}
+
+	if domCfg.Devices != nil {
+		for _, disk := range domCfg.Devices.Disks {
+			if disk.Source == nil || disk.Target == nil {
+				continue
+			}
+
+			if (disk.Source.File != nil && disk.Source.File.File == path) || (disk.Source.Block != nil && disk.Source.Block.Dev == path) {
+				return disk.Target.Dev, nil
+			}
+		}
+	}
+
+	fail.Printf("%sfailed to find disk with path %s in domain XML\n", id, path)
+	return "", fmt.Errorf("failed to find disk with path %s in domain XML", path)
+}
+
+// resizes volume, volume of running domain is resized live through domain block device
+func resizePoolVolume(ctx context.Context, c *libvirt.Connect, pool, name string, capacity uint64) error {
+	id := getReqIDFromContext(ctx)
+
+	v, err := lookupPoolVolume(ctx, c, pool, name)
+	if err != nil {
+		return err
+	}
+	defer freeVolume(ctx, v)
+
+	path, err := getVolumePath(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	volInfo, err := v.GetInfo()
+	if err != nil {
+		fail.Printf("%sfailed to get storage volume info: %s\n", id, err.Error())
+		return err
+	}
+
+	// block resize of running domain would truncate guest disk
+	if capacity < volInfo.Capacity {
+		fail.Printf("%sstorage volume %s can not be shrunk from %d to %d bytes\n", id, path, volInfo.Capacity, capacity)
+		return fmt.Errorf("storage volume %s can not be shrunk from %d to %d bytes", path, volInfo.Capacity, capacity)
+	}
+
+	err = checkVolumeHasNoOverlays(ctx, c, path)
+	if err != nil {
+		return err
+	}
+
+	users, err := getVolumeUsers(ctx, c, path)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		d, err := lookupDomainByName(ctx, c, user)
+		if err != nil {
+			return err
+		}
+
+		if !isDomainActive(ctx, d) {
+			freeDomain(ctx, d)
+			continue
+		}
+
+		defer freeDomain(ctx, d)
+
+		ok, err := isDomainBlockJobRunning(ctx, d)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return errors.New("sanity lock, block device job is currently in process")
+		}
+
+		dev, err := getDomainDiskTargetByPath(ctx, d, path)
+		if err != nil {
+			return err
+		}
+
+		err = d.BlockResize(dev, capacity, libvirt.DOMAIN_BLOCK_RESIZE_BYTES)
+		if err != nil {
+			fail.Printf("%sfailed to resize block device %s of domain %s: %s\n", id, dev, user, err.Error())
+			return err
+		}
+
+		info.Printf("%sresized block device %s of running domain %s to %d bytes\n", id, dev, user, capacity)
+		return nil
+	}
+
+	err = v.Resize(capacity, 0)
+	if err != nil {
+		fail.Printf("%sfailed to resize storage volume %s: %s\n", id, path, err.Error())
+		return err
+	}
+
+	info.Printf("%sresized storage volume %s to %d bytes\n", id, path, capacity)
+	return nil
+}
+
+// returns paths of volumes which use volume with supplied path as backing file, linked clones are created in storage pool of their template, so only that pool is scanned
+func getVolumeOverlays(ctx context.Context, c *libvirt.Connect, path string) ([]string, error) {
+	vol, err := lookupStorageVolByPath(ctx, c, path)
+	if err != nil {
+		return nil, err
+	}
+	defer freeVolume(ctx, vol)
+
+	pool, err := lookupPoolByVolume(ctx, vol)
+	if err != nil {
+		return nil, err
+	}
+	defer freePool(ctx, pool)
+
+	vols, err := listAllStorgeVolumesInPool(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	defer freeVolumes(ctx, vols)
+
+	overlays := make([]string, 0)
+
+	for i := range vols {
+		v, err := getVolumeInfoResponse(ctx, &vols[i], nil)
+		if err != nil {
+			continue
+		}
+
+		if v.BackingStore == path {
+			overlays = append(overlays, v.Path)
+		}
+	}
+
+	return overlays, nil
+}
+
+// base volume of linked clones is read-only, overlays are searched in pool of volume, so every write, delete or move of volume must pass this check
+func checkVolumeHasNoOverlays(ctx context.Context, c *libvirt.Connect, path string) error {
+	id := getReqIDFromContext(ctx)
+
+	overlays, err := getVolumeOverlays(ctx, c, path)
+	if err != nil {
+		return err
+	}
+
+	if len(overlays) != 0 {
+		fail.Printf("%svolume %s is backing file of linked clone(s): %s\n", id, path, strings.Join(overlays, ", "))
+		return fmt.Errorf("volume %s is backing file of linked clone(s): %s", path, strings.Join(overlays, ", "))
+	}
+
+	return nil
+}
+
+// detaches linked clone from its base, block pull is started for volume of running domain, offline volume is rebased in place
+func flattenPoolVolume(ctx context.Context, c *libvirt.Connect, pool, name string) error {
+	id := getReqIDFromContext(ctx)
+
+	v, err := lookupPoolVolume(ctx, c, pool, name)
+	if err != nil {
+		return err
+	}
+	defer freeVolume(ctx, v)
+
+	vol, err := getVolumeInfoResponse(ctx, v, nil)
+	if err != nil {
+		return err
+	}
+
+	if len(vol.BackingStore) == 0 {
+		fail.Printf("%svolume %s has no backing store, nothing to flatten\n", id, vol.Path)
+		return fmt.Errorf("volume %s has no backing store, nothing to flatten", vol.Path)
+	}
+
+	users, err := getVolumeUsers(ctx, c, vol.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		d, err := lookupDomainByName(ctx, c, user)
+		if err != nil {
+			return err
+		}
+
+		if !isDomainActive(ctx, d) {
+			freeDomain(ctx, d)
+			continue
+		}
+
+		defer freeDomain(ctx, d)
+
+		ok, err := isDomainBlockJobRunning(ctx, d)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return errors.New("sanity lock, block device job is currently in process")
+		}
+
+		dev, err := getDomainDiskTargetByPath(ctx, d, vol.Path)
+		if err != nil {
+			return err
+		}
+
+		err = d.BlockPull(dev, 0, 0)
+		if err != nil {
+			fail.Printf("%sfailed to start block pull of %s for domain %s: %s\n", id, dev, user, err.Error())
+			return err
+		}
+
+		info.Printf("%sstarted block pull of %s for running domain %s\n", id, dev, user)
+		return nil
+	}
+
+	// safe mode rebase onto no backing file copies all data of backing chain into volume
+	out, err := exec.CommandContext(ctx, "qemu-img", "rebase", "-f", vol.Format, "-b", "", vol.Path).CombinedOutput()
+	if err != nil {
+		fail.Printf("%sfailed to rebase volume %s: %s, output: %s\n", id, vol.Path, err.Error(), strings.TrimSpace(string(out)))
+		return fmt.Errorf("failed to rebase volume %s: %s", vol.Path, err.Error())
+	}
+
+	p, err := lookupPoolByName(ctx, c, pool)
+	if err != nil {
+		return err
+	}
+	defer freePool(ctx, p)
+
+	err = refreshPool(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	info.Printf("%sflattened volume %s, detached from %s\n", id, vol.Path, vol.BackingStore)
+	return nil
+}